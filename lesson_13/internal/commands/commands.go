@@ -14,10 +14,19 @@ const (
 	ListColCommandName   string = "list"   // List documents in the collection
 	DeleteColCommandName string = "delete" // Delete a collection from the store
 
-	ColStorageName       string = "collection"
-	PutDocCommandName    string = "put"    // Put a document in the collection
-	GetDocCommandName    string = "get"    // Get a document from the collection
-	DeleteDocCommandName string = "delete" // Delete a document from the collection
+	ColStorageName        string = "collection"
+	PutDocCommandName     string = "put"       // Put a document in the collection
+	GetDocCommandName     string = "get"       // Get a document from the collection
+	DeleteDocCommandName  string = "delete"    // Delete a document from the collection
+	QueryDocCommandName   string = "query"     // Query a range of an index of the collection
+	IndexColCommandName   string = "index"     // Create an index in the collection
+	AggregateCommandName  string = "aggregate" // Run an aggregation pipeline over the collection
+	ExplainCommandName    string = "explain"   // Explain how a query or filter runs
+	UpdateDocCommandName  string = "update"    // Update fields of a document in the collection
+	InsertDocCommandName  string = "insert"    // Put a document that must not exist yet
+	ReplaceDocCommandName string = "replace"   // Put a document that must exist already
+	UpsertDocCommandName  string = "upsert"    // Put a document, reporting whether it was created
+	BulkDocCommandName    string = "bulk"      // Write and delete many documents at once
 )
 
 var store = documentstore.NewStore()
@@ -31,21 +40,123 @@ type DeleteColCommandRequestPayload struct {
 }
 
 type ListColCommandRequestPayload struct {
-	Name string `json:"name"` // Collection Name
+	Name   string `json:"name"`             // Collection Name
+	Desc   bool   `json:"desc,omitempty"`   // List in descending primary key order
+	Skip   int    `json:"skip,omitempty"`   // Number of documents to skip
+	Limit  int    `json:"limit,omitempty"`  // Maximum number of documents, 0 for all
+	Cursor string `json:"cursor,omitempty"` // Cursor returned with the previous page
+
+	Sort       []documentstore.SortField `json:"sort,omitempty"`       // Fields to order by instead of the primary key
+	Projection *documentstore.Projection `json:"projection,omitempty"` // Fields to include or exclude
 }
 type PutDocCommandNameRequestPayload struct {
-	Name string                 `json:"name"` // Collection Name
-	Doc  map[string]interface{} `json:"doc"`
+	Name     string                 `json:"name"` // Collection Name
+	Doc      map[string]interface{} `json:"doc"`
+	Revision *uint64                `json:"revision,omitempty"` // Put only if the stored document is at this revision, 0 for none
 }
 
 type GetDocCommandNameRequestPayload struct {
-	Name string `json:"name"` // Collection Name
-	Id   string `json:"Id"`   // Document ID
+	Name       string                    `json:"name"`                 // Collection Name
+	Id         string                    `json:"Id"`                   // Document ID
+	Projection *documentstore.Projection `json:"projection,omitempty"` // Fields to include or exclude
 }
 
 type DeleteDocCommandNameRequestPayload struct {
-	Name string `json:"name"` // Collection Name
-	Id   string `json:"Id"`   // Document ID
+	Name     string  `json:"name"`               // Collection Name
+	Id       string  `json:"Id"`                 // Document ID
+	Revision *uint64 `json:"revision,omitempty"` // Delete only if the document is at this revision
+}
+
+type UpdateDocCommandRequestPayload struct {
+	Name    string                 `json:"name"`    // Collection Name
+	Id      string                 `json:"Id"`      // Document ID
+	Updates []documentstore.Update `json:"updates"` // Update operators, applied in order
+}
+
+type BulkDocCommandRequestPayload struct {
+	Name string          `json:"name"` // Collection Name
+	Ops  []BulkOpPayload `json:"ops"`  // Operations, run in order
+	documentstore.BulkOptions
+}
+
+// BulkOpPayload writes Doc in Mode, or deletes the document Delete.
+type BulkOpPayload struct {
+	Mode   documentstore.WriteMode `json:"mode,omitempty"`   // insert, replace or upsert, the default
+	Doc    map[string]interface{}  `json:"doc,omitempty"`    // Document to write
+	Delete string                  `json:"delete,omitempty"` // Document ID to delete
+}
+
+type QueryDocCommandRequestPayload struct {
+	Name         string `json:"name"`                    // Collection Name
+	Index        string `json:"index"`                   // Index Name
+	Desc         bool   `json:"desc,omitempty"`          // Return documents in reverse index order
+	Prefix       []any  `json:"prefix,omitempty"`        // Values of the leading fields of a compound index
+	MinValue     any    `json:"min,omitempty"`           // Lower bound
+	MaxValue     any    `json:"max,omitempty"`           // Upper bound
+	MinExclusive bool   `json:"min_exclusive,omitempty"` // Exclude the lower bound itself
+	MaxExclusive bool   `json:"max_exclusive,omitempty"` // Exclude the upper bound itself
+	StartsWith   string `json:"starts_with,omitempty"`   // String prefix of the field after Prefix
+	Skip         int    `json:"skip,omitempty"`          // Number of documents to skip
+	Limit        int    `json:"limit,omitempty"`         // Maximum number of documents, 0 for all
+	Cursor       string `json:"cursor,omitempty"`        // Cursor returned with the previous page
+
+	Sort       []documentstore.SortField `json:"sort,omitempty"`       // Fields to order by instead of the index
+	Projection *documentstore.Projection `json:"projection,omitempty"` // Fields to include or exclude
+}
+
+// queryParams returns the query parameters of the payload.
+func (p *QueryDocCommandRequestPayload) queryParams() documentstore.QueryParams {
+	return documentstore.QueryParams{
+		Desc:     p.Desc,
+		Prefix:   p.Prefix,
+		MinValue: p.MinValue,
+		MaxValue: p.MaxValue,
+
+		MinExclusive: p.MinExclusive,
+		MaxExclusive: p.MaxExclusive,
+		StartsWith:   p.StartsWith,
+
+		Skip:   p.Skip,
+		Limit:  p.Limit,
+		Cursor: p.Cursor,
+
+		Sort:       p.Sort,
+		Projection: p.Projection,
+	}
+}
+
+// ExplainCommandRequestPayload explains a Find with Filter if it is set, or
+// otherwise the query described by the other fields.
+type ExplainCommandRequestPayload struct {
+	QueryDocCommandRequestPayload
+	Filter *documentstore.Filter `json:"filter,omitempty"` // Filter to explain instead of a query
+}
+
+type IndexColCommandRequestPayload struct {
+	Name  string                    `json:"name"`  // Collection Name
+	Index documentstore.IndexConfig `json:"index"` // Field name or index config
+}
+
+type AggregateCommandRequestPayload struct {
+	Name     string                `json:"name"`     // Collection Name
+	Pipeline []documentstore.Stage `json:"pipeline"` // Aggregation stages
+}
+
+type AggregateCommandResponsePayload struct {
+	Status string                   `json:"status"`
+	Value  string                   `json:"value"`
+	Docs   []documentstore.Document `json:"docs"`
+}
+
+type ExplainCommandResponsePayload struct {
+	Status  string                `json:"status"`
+	Value   string                `json:"value"`
+	Explain documentstore.Explain `json:"explain"`
+}
+
+type IndexColCommandResponsePayload struct {
+	Status string `json:"status"`
+	Value  string `json:"value"`
 }
 
 type CreateColCommandResponsePayload struct {
@@ -62,6 +173,14 @@ type ListColCommandResponsePayload struct {
 	Status string                   `json:"status"`
 	Value  string                   `json:"value"`
 	Docs   []documentstore.Document `json:"docs"`
+	Cursor string                   `json:"cursor,omitempty"`
+}
+
+type QueryDocCommandResponsePayload struct {
+	Status string                   `json:"status"`
+	Value  string                   `json:"value"`
+	Docs   []documentstore.Document `json:"docs"`
+	Cursor string                   `json:"cursor,omitempty"`
 }
 
 type PutDocCommandNameResponsePayload struct {
@@ -75,6 +194,31 @@ type GetDocCommandNameResponsePayload struct {
 	Doc    documentstore.Document `json:"doc"`
 }
 
+type UpdateDocCommandResponsePayload struct {
+	Status string                 `json:"status"`
+	Value  string                 `json:"value"`
+	Doc    documentstore.Document `json:"doc"`
+}
+
+// WriteDocCommandResponsePayload answers insert, replace and upsert.
+type WriteDocCommandResponsePayload struct {
+	Status string `json:"status"`
+	Value  string `json:"value"`
+	Result string `json:"result"` // "created" or "replaced"
+}
+
+type BulkDocCommandResponsePayload struct {
+	Status string `json:"status"` // "success", or "error" if any operation failed
+	Value  string `json:"value"`
+	documentstore.BulkResult
+	Errors []BulkErrorPayload `json:"errors,omitempty"`
+}
+
+type BulkErrorPayload struct {
+	Index int    `json:"index"` // Position of the operation in the request
+	Error string `json:"error"`
+}
+
 type DeleteDocCommandNameResponsePayload struct {
 	Status string `json:"status"`
 	Value  string `json:"value"`
@@ -102,6 +246,24 @@ func ExecCol(command string, param string) (resp string, err error) {
 		resp, err = ExecGetDoc(param)
 	case DeleteDocCommandName:
 		resp, err = ExecDeleteDoc(param)
+	case QueryDocCommandName:
+		resp, err = ExecQueryDoc(param)
+	case IndexColCommandName:
+		resp, err = ExecIndexCol(param)
+	case AggregateCommandName:
+		resp, err = ExecAggregate(param)
+	case ExplainCommandName:
+		resp, err = ExecExplain(param)
+	case UpdateDocCommandName:
+		resp, err = ExecUpdateDoc(param)
+	case InsertDocCommandName:
+		resp, err = ExecWriteDoc(param, documentstore.WriteInsert)
+	case ReplaceDocCommandName:
+		resp, err = ExecWriteDoc(param, documentstore.WriteReplace)
+	case UpsertDocCommandName:
+		resp, err = ExecWriteDoc(param, documentstore.WriteUpsert)
+	case BulkDocCommandName:
+		resp, err = ExecBulkDoc(param)
 	default:
 		return "", fmt.Errorf("unknown command: %s", command)
 	}
@@ -143,10 +305,24 @@ func ExecListCol(param string) (string, error) {
 		return "", fmt.Errorf("collection getting error: %w", err)
 	}
 
+	page, err := col.ListPage(documentstore.QueryParams{
+		Desc:   p.Desc,
+		Skip:   p.Skip,
+		Limit:  p.Limit,
+		Cursor: p.Cursor,
+
+		Sort:       p.Sort,
+		Projection: p.Projection,
+	})
+	if err != nil {
+		return "", fmt.Errorf("collection listing error: %w", err)
+	}
+
 	r := ListColCommandResponsePayload{
 		Status: "success",
 		Value:  p.Name,
-		Docs:   col.List(),
+		Docs:   page.Documents,
+		Cursor: page.Cursor,
 	}
 
 	resp, merr := json.Marshal(r)
@@ -189,15 +365,19 @@ func ExecPutDoc(param string) (string, error) {
 
 	doc, merr := documentstore.MarshalDocument(p.Doc)
 	if merr != nil {
-		return "", fmt.Errorf("marshal error: %w", err)
+		return "", fmt.Errorf("marshal error: %w", merr)
 	}
 
 	collection, cerr := store.GetCollection(p.Name)
 	if cerr != nil {
-		return "", fmt.Errorf("collection getting error: %w", err)
+		return "", fmt.Errorf("collection getting error: %w", cerr)
 	}
 
-	err = collection.Put(*doc)
+	if p.Revision != nil {
+		err = collection.PutIfRevision(*doc, *p.Revision)
+	} else {
+		err = collection.Put(*doc)
+	}
 	if err != nil {
 		return "", fmt.Errorf("put error: %w", err)
 	}
@@ -215,6 +395,99 @@ func ExecPutDoc(param string) (string, error) {
 
 }
 
+// ExecWriteDoc runs the insert, replace and upsert commands, which take the
+// put payload.
+func ExecWriteDoc(param string, mode documentstore.WriteMode) (string, error) {
+	p := &PutDocCommandNameRequestPayload{}
+	err := json.Unmarshal([]byte(param), p)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal error: %w", err)
+	}
+
+	doc, err := documentstore.MarshalDocument(p.Doc)
+	if err != nil {
+		return "", fmt.Errorf("marshal error: %w", err)
+	}
+
+	collection, err := store.GetCollection(p.Name)
+	if err != nil {
+		return "", fmt.Errorf("collection getting error: %w", err)
+	}
+
+	created, err := collection.Write(*doc, mode, p.Revision)
+	if err != nil {
+		return "", fmt.Errorf("%s error: %w", mode, err)
+	}
+
+	r := WriteDocCommandResponsePayload{
+		Status: "success",
+		Value:  p.Name,
+		Result: "replaced",
+	}
+	if created {
+		r.Result = "created"
+	}
+
+	resp, merr := json.Marshal(r)
+	if merr != nil {
+		log.Println("internal error:", merr)
+		return "", errors.New("internal error")
+	}
+	return string(resp), nil
+}
+
+func ExecBulkDoc(param string) (string, error) {
+	p := &BulkDocCommandRequestPayload{}
+	err := json.Unmarshal([]byte(param), p)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal error: %w", err)
+	}
+
+	ops := make([]documentstore.BulkOp, len(p.Ops))
+	for i, op := range p.Ops {
+		ops[i] = documentstore.BulkOp{Mode: op.Mode, Delete: op.Delete}
+		if op.Doc != nil {
+			if ops[i].Document, err = documentstore.MarshalDocument(op.Doc); err != nil {
+				return "", fmt.Errorf("marshal error: operation %d: %w", i, err)
+			}
+		}
+	}
+
+	collection, err := store.GetCollection(p.Name)
+	if err != nil {
+		return "", fmt.Errorf("collection getting error: %w", err)
+	}
+
+	res, err := collection.Bulk(ops, p.BulkOptions)
+	r := BulkDocCommandResponsePayload{
+		Status:     "success",
+		Value:      p.Name,
+		BulkResult: res,
+	}
+	if err != nil {
+		// Failed operations are reported in the response, anything else
+		// failed the whole call.
+		joined, ok := err.(interface{ Unwrap() []error })
+		if !ok {
+			return "", fmt.Errorf("bulk error: %w", err)
+		}
+		r.Status = "error"
+		for _, e := range joined.Unwrap() {
+			var bulkErr *documentstore.BulkError
+			if errors.As(e, &bulkErr) {
+				r.Errors = append(r.Errors, BulkErrorPayload{Index: bulkErr.Index, Error: bulkErr.Err.Error()})
+			}
+		}
+	}
+
+	resp, merr := json.Marshal(r)
+	if merr != nil {
+		log.Println("internal error:", merr)
+		return "", errors.New("internal error")
+	}
+	return string(resp), nil
+}
+
 func ExecGetDoc(param string) (string, error) {
 	p := &GetDocCommandNameRequestPayload{}
 	err := json.Unmarshal([]byte(param), p)
@@ -224,12 +497,18 @@ func ExecGetDoc(param string) (string, error) {
 
 	collection, cerr := store.GetCollection(p.Name)
 	if cerr != nil {
-		return "", fmt.Errorf("collection getting error: %w", err)
+		return "", fmt.Errorf("collection getting error: %w", cerr)
 	}
 
-	doc, derr := collection.Get(p.Id)
+	var doc *documentstore.Document
+	var derr error
+	if p.Projection != nil {
+		doc, derr = collection.GetProjected(p.Id, *p.Projection)
+	} else {
+		doc, derr = collection.Get(p.Id)
+	}
 	if derr != nil {
-		return "", fmt.Errorf("document getting error: %w", err)
+		return "", fmt.Errorf("document getting error: %w", derr)
 	}
 
 	r := GetDocCommandNameResponsePayload{
@@ -255,12 +534,17 @@ func ExecDeleteDoc(param string) (string, error) {
 
 	collection, cerr := store.GetCollection(p.Name)
 	if cerr != nil {
-		return "", fmt.Errorf("collection getting error: %w", err)
+		return "", fmt.Errorf("collection getting error: %w", cerr)
 	}
 
-	derr := collection.Delete(p.Id)
+	var derr error
+	if p.Revision != nil {
+		derr = collection.DeleteIfRevision(p.Id, *p.Revision)
+	} else {
+		derr = collection.Delete(p.Id)
+	}
 	if derr != nil {
-		return "", fmt.Errorf("document getting error: %w", err)
+		return "", fmt.Errorf("document deleting error: %w", derr)
 	}
 
 	r := DeleteDocCommandNameResponsePayload{
@@ -275,3 +559,162 @@ func ExecDeleteDoc(param string) (string, error) {
 	}
 	return string(resp), nil
 }
+
+func ExecUpdateDoc(param string) (string, error) {
+	p := &UpdateDocCommandRequestPayload{}
+	err := json.Unmarshal([]byte(param), p)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal error: %w", err)
+	}
+
+	collection, err := store.GetCollection(p.Name)
+	if err != nil {
+		return "", fmt.Errorf("collection getting error: %w", err)
+	}
+
+	doc, err := collection.Update(p.Id, p.Updates...)
+	if err != nil {
+		return "", fmt.Errorf("update error: %w", err)
+	}
+
+	r := UpdateDocCommandResponsePayload{
+		Status: "success",
+		Value:  p.Id,
+		Doc:    *doc,
+	}
+
+	resp, merr := json.Marshal(r)
+	if merr != nil {
+		log.Println("internal error:", merr)
+		return "", errors.New("internal error")
+	}
+	return string(resp), nil
+}
+
+func ExecQueryDoc(param string) (string, error) {
+	p := &QueryDocCommandRequestPayload{}
+	err := json.Unmarshal([]byte(param), p)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal error: %w", err)
+	}
+
+	collection, err := store.GetCollection(p.Name)
+	if err != nil {
+		return "", fmt.Errorf("collection getting error: %w", err)
+	}
+
+	page, err := collection.QueryPage(p.Index, p.queryParams())
+	if err != nil {
+		return "", fmt.Errorf("query error: %w", err)
+	}
+
+	r := QueryDocCommandResponsePayload{
+		Status: "success",
+		Value:  p.Index,
+		Docs:   page.Documents,
+		Cursor: page.Cursor,
+	}
+
+	resp, merr := json.Marshal(r)
+	if merr != nil {
+		log.Println("internal error:", merr)
+		return "", errors.New("internal error")
+	}
+	return string(resp), nil
+}
+
+func ExecIndexCol(param string) (string, error) {
+	p := &IndexColCommandRequestPayload{}
+	err := json.Unmarshal([]byte(param), p)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal error: %w", err)
+	}
+
+	collection, err := store.GetCollection(p.Name)
+	if err != nil {
+		return "", fmt.Errorf("collection getting error: %w", err)
+	}
+
+	if err := collection.CreateIndexWithConfig(p.Index); err != nil {
+		return "", fmt.Errorf("index creation error: %w", err)
+	}
+
+	r := IndexColCommandResponsePayload{
+		Status: "created",
+		Value:  p.Name,
+	}
+
+	resp, merr := json.Marshal(r)
+	if merr != nil {
+		log.Println("internal error:", merr)
+		return "", errors.New("internal error")
+	}
+	return string(resp), nil
+}
+
+func ExecAggregate(param string) (string, error) {
+	p := &AggregateCommandRequestPayload{}
+	err := json.Unmarshal([]byte(param), p)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal error: %w", err)
+	}
+
+	collection, err := store.GetCollection(p.Name)
+	if err != nil {
+		return "", fmt.Errorf("collection getting error: %w", err)
+	}
+
+	docs, err := collection.Aggregate(p.Pipeline)
+	if err != nil {
+		return "", fmt.Errorf("aggregation error: %w", err)
+	}
+
+	r := AggregateCommandResponsePayload{
+		Status: "success",
+		Value:  p.Name,
+		Docs:   docs,
+	}
+
+	resp, merr := json.Marshal(r)
+	if merr != nil {
+		log.Println("internal error:", merr)
+		return "", errors.New("internal error")
+	}
+	return string(resp), nil
+}
+
+func ExecExplain(param string) (string, error) {
+	p := &ExplainCommandRequestPayload{}
+	err := json.Unmarshal([]byte(param), p)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal error: %w", err)
+	}
+
+	collection, err := store.GetCollection(p.Name)
+	if err != nil {
+		return "", fmt.Errorf("collection getting error: %w", err)
+	}
+
+	var explain documentstore.Explain
+	if p.Filter != nil {
+		explain, err = collection.ExplainFind(*p.Filter)
+	} else {
+		explain, err = collection.ExplainQuery(p.Index, p.queryParams())
+	}
+	if err != nil {
+		return "", fmt.Errorf("explain error: %w", err)
+	}
+
+	r := ExplainCommandResponsePayload{
+		Status:  "success",
+		Value:   p.Name,
+		Explain: explain,
+	}
+
+	resp, merr := json.Marshal(r)
+	if merr != nil {
+		log.Println("internal error:", merr)
+		return "", errors.New("internal error")
+	}
+	return string(resp), nil
+}
@@ -0,0 +1,268 @@
+package documentstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Stage is one step of an aggregation pipeline. Exactly one of its fields
+// must be set.
+type Stage struct {
+	Match   *Filter     `json:"match,omitempty"`   // keep the documents matching the filter
+	Group   *GroupStage `json:"group,omitempty"`   // fold the documents into one per group
+	Sort    []SortField `json:"sort,omitempty"`    // order the documents
+	Skip    int         `json:"skip,omitempty"`    // drop the first documents
+	Limit   int         `json:"limit,omitempty"`   // keep the first documents
+	Project *Projection `json:"project,omitempty"` // keep or drop fields, the primary key is not special
+	Unwind  string      `json:"unwind,omitempty"`  // emit a document per element of an array field
+}
+
+// GroupStage groups documents by the values at the By paths and computes
+// the accumulators over each group. Every group becomes a document holding
+// the By values under their paths and the accumulator results under their
+// names. Without By all documents form a single group.
+type GroupStage struct {
+	By           []string               `json:"by,omitempty"`
+	Accumulators map[string]Accumulator `json:"accumulators"`
+}
+
+type AccumulatorOp string
+
+const (
+	AccumulatorCount AccumulatorOp = "count"
+	AccumulatorSum   AccumulatorOp = "sum"
+	AccumulatorAvg   AccumulatorOp = "avg"
+	AccumulatorMin   AccumulatorOp = "min"
+	AccumulatorMax   AccumulatorOp = "max"
+)
+
+// Accumulator computes a value over the documents of a group. Count counts
+// the documents; sum and avg only take numbers into account, min and max
+// values of any type. An accumulator with no values to work on is left out
+// of the group document, except count.
+type Accumulator struct {
+	Op    AccumulatorOp `json:"op"`
+	Field string        `json:"field,omitempty"`
+}
+
+func (st Stage) validate() error {
+	set := 0
+	for _, ok := range []bool{st.Match != nil, st.Group != nil, st.Sort != nil, st.Skip != 0, st.Limit != 0, st.Project != nil, st.Unwind != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("%w: a stage must have exactly one operation", ErrInvalidQuery)
+	}
+
+	switch {
+	case st.Match != nil:
+		return st.Match.validate()
+	case st.Group != nil:
+		for _, path := range st.Group.By {
+			if !validPath(path) {
+				return fmt.Errorf("%w: invalid group path %q", ErrInvalidQuery, path)
+			}
+		}
+		for name, acc := range st.Group.Accumulators {
+			if name == "" {
+				return fmt.Errorf("%w: unnamed accumulator", ErrInvalidQuery)
+			}
+			switch acc.Op {
+			case AccumulatorCount:
+				continue
+			case AccumulatorSum, AccumulatorAvg, AccumulatorMin, AccumulatorMax:
+			default:
+				return fmt.Errorf("%w: unknown accumulator %q", ErrInvalidQuery, acc.Op)
+			}
+			if !validPath(acc.Field) {
+				return fmt.Errorf("%w: invalid accumulator field %q", ErrInvalidQuery, acc.Field)
+			}
+		}
+	case st.Sort != nil:
+		return validateSort(st.Sort)
+	case st.Skip < 0 || st.Limit < 0:
+		return fmt.Errorf("%w: negative skip or limit", ErrInvalidQuery)
+	case st.Project != nil:
+		return st.Project.validate()
+	case st.Unwind != "":
+		if !validPath(st.Unwind) {
+			return fmt.Errorf("%w: invalid unwind path %q", ErrInvalidQuery, st.Unwind)
+		}
+	}
+	return nil
+}
+
+// Aggregate runs the documents of the collection through the pipeline and
+// returns the documents coming out of the last stage. A leading match stage
+// is planned like Find and can use an index. The pipeline runs on a
+// snapshot of the collection.
+func (s *Collection) Aggregate(pipeline []Stage) ([]Document, error) {
+	for i, st := range pipeline {
+		if err := st.validate(); err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i, err)
+		}
+	}
+
+	match := Filter{Op: FilterAnd}
+	if len(pipeline) > 0 && pipeline[0].Match != nil {
+		match = *pipeline[0].Match
+		pipeline = pipeline[1:]
+	}
+
+	var docs []Document
+	s.Snapshot().find(match, nil, func(_ string, doc Document) bool {
+		docs = append(docs, doc)
+		return true
+	})
+
+	for _, st := range pipeline {
+		docs = st.apply(docs)
+	}
+	return docs, nil
+}
+
+// apply runs a validated stage. Documents are never modified in place,
+// stages that change them build new ones.
+func (st Stage) apply(docs []Document) []Document {
+	switch {
+	case st.Match != nil:
+		out := docs[:0:0]
+		for _, doc := range docs {
+			if st.Match.match(doc) {
+				out = append(out, doc)
+			}
+		}
+		return out
+	case st.Group != nil:
+		return st.Group.apply(docs)
+	case st.Sort != nil:
+		sortDocuments(docs, st.Sort)
+		return docs
+	case st.Skip > 0:
+		return docs[min(st.Skip, len(docs)):]
+	case st.Limit > 0:
+		return docs[:min(st.Limit, len(docs))]
+	case st.Project != nil:
+		out := make([]Document, len(docs))
+		for i, doc := range docs {
+			out[i] = st.Project.apply(doc, "")
+		}
+		return out
+	case st.Unwind != "":
+		var out []Document
+		for _, doc := range docs {
+			field, ok := doc.Lookup(st.Unwind)
+			if !ok || field.Type != DocumentFieldTypeArray {
+				continue
+			}
+			rv := reflect.ValueOf(field.Value)
+			if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+				continue
+			}
+			for i := 0; i < rv.Len(); i++ {
+				if elem, ok := fieldOf(rv.Index(i).Interface()); ok {
+					out = append(out, doc.withField(st.Unwind, elem))
+				}
+			}
+		}
+		return out
+	}
+	return docs
+}
+
+type group struct {
+	key    []any
+	count  int
+	sums   map[string]float64
+	counts map[string]int // numbers summed per accumulator
+	values map[string]any // min and max so far
+}
+
+func (g *GroupStage) apply(docs []Document) []Document {
+	groups := make(map[string]*group)
+	var order []*group
+
+	for _, doc := range docs {
+		key := make([]any, len(g.By))
+		for i, path := range g.By {
+			key[i] = sortValue(doc, path)
+		}
+		id, _ := json.Marshal(key)
+		grp, ok := groups[string(id)]
+		if !ok {
+			grp = &group{key: key, sums: map[string]float64{}, counts: map[string]int{}, values: map[string]any{}}
+			groups[string(id)] = grp
+			order = append(order, grp)
+		}
+		grp.count++
+
+		for name, acc := range g.Accumulators {
+			if acc.Op == AccumulatorCount {
+				continue
+			}
+			v := sortValue(doc, acc.Field)
+			switch acc.Op {
+			case AccumulatorSum, AccumulatorAvg:
+				if n, ok := v.(float64); ok {
+					grp.sums[name] += n
+					grp.counts[name]++
+				}
+			case AccumulatorMin, AccumulatorMax:
+				if v == nil {
+					continue
+				}
+				cur, seen := grp.values[name]
+				c := compareValues(v, cur)
+				if !seen || acc.Op == AccumulatorMin && c < 0 || acc.Op == AccumulatorMax && c > 0 {
+					grp.values[name] = v
+				}
+			}
+		}
+	}
+
+	// Groups come out ordered by their key.
+	sort.SliceStable(order, func(i, j int) bool {
+		for k := range g.By {
+			if c := compareValues(order[i].key[k], order[j].key[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	out := make([]Document, len(order))
+	for i, grp := range order {
+		doc := Document{Fields: map[string]DocumentField{}}
+		for k, path := range g.By {
+			if f, ok := fieldOf(grp.key[k]); ok {
+				doc = doc.withField(path, f)
+			}
+		}
+		for name, acc := range g.Accumulators {
+			var v any
+			switch acc.Op {
+			case AccumulatorCount:
+				v = float64(grp.count)
+			case AccumulatorSum:
+				if grp.counts[name] > 0 {
+					v = grp.sums[name]
+				}
+			case AccumulatorAvg:
+				if n := grp.counts[name]; n > 0 {
+					v = grp.sums[name] / float64(n)
+				}
+			case AccumulatorMin, AccumulatorMax:
+				v = grp.values[name]
+			}
+			if f, ok := fieldOf(v); ok {
+				doc.Fields[name] = f
+			}
+		}
+		out[i] = doc
+	}
+	return out
+}
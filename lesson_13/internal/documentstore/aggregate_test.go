@@ -0,0 +1,181 @@
+package documentstore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupOrdersCollection(t *testing.T) *Collection {
+	coll := &Collection{
+		cfg:       CollectionConfig{PrimaryKey: "id"},
+		documents: map[string]Document{},
+	}
+	for _, o := range []map[string]any{
+		{"id": "1", "customer": "alice", "total": 10, "items": []any{"pen", "ink"}, "shipping": map[string]any{"city": "Kyiv"}},
+		{"id": "2", "customer": "bob", "total": 25.5, "items": []any{"book"}, "shipping": map[string]any{"city": "Lviv"}},
+		{"id": "3", "customer": "alice", "total": 4.5, "items": []any{}, "shipping": map[string]any{"city": "Lviv"}},
+		{"id": "4", "customer": "carol", "total": "n/a", "items": []any{"pen"}},
+		{"id": "5", "customer": "bob", "total": 30, "items": []any{"pen", "book"}, "shipping": map[string]any{"city": "Kyiv"}},
+	} {
+		doc, _ := MarshalDocument(o)
+		assert.NoError(t, coll.Put(*doc))
+	}
+	return coll
+}
+
+// plain converts documents to maps of normalized values for comparisons.
+func plain(docs []Document) []map[string]any {
+	out := make([]map[string]any, len(docs))
+	for i, doc := range docs {
+		out[i] = map[string]any{}
+		for name, f := range doc.Fields {
+			if inner, ok := f.Value.(Document); ok {
+				out[i][name] = plain([]Document{inner})[0]
+				continue
+			}
+			out[i][name] = normalizeValue(f.Value)
+		}
+	}
+	return out
+}
+
+func TestAggregate(t *testing.T) {
+	coll := setupOrdersCollection(t)
+
+	tests := []struct {
+		name     string
+		pipeline []Stage
+		want     []map[string]any
+	}{
+		{
+			name: "group by customer",
+			pipeline: []Stage{
+				{Group: &GroupStage{By: []string{"customer"}, Accumulators: map[string]Accumulator{
+					"orders": {Op: AccumulatorCount},
+					"spent":  {Op: AccumulatorSum, Field: "total"},
+					"avg":    {Op: AccumulatorAvg, Field: "total"},
+					"least":  {Op: AccumulatorMin, Field: "total"},
+					"most":   {Op: AccumulatorMax, Field: "total"},
+				}}},
+			},
+			want: []map[string]any{
+				{"customer": "alice", "orders": 2.0, "spent": 14.5, "avg": 7.25, "least": 4.5, "most": 10.0},
+				{"customer": "bob", "orders": 2.0, "spent": 55.5, "avg": 27.75, "least": 25.5, "most": 30.0},
+				// carol has no numeric total to sum or average.
+				{"customer": "carol", "orders": 1.0, "least": "n/a", "most": "n/a"},
+			},
+		},
+		{
+			name: "match, group by nested path, sort and limit",
+			pipeline: []Stage{
+				{Match: ptr(Gt("total", 5))},
+				{Group: &GroupStage{By: []string{"shipping.city"}, Accumulators: map[string]Accumulator{
+					"spent": {Op: AccumulatorSum, Field: "total"},
+				}}},
+				{Sort: []SortField{{Field: "spent", Desc: true}}},
+				{Limit: 1},
+			},
+			want: []map[string]any{
+				{"shipping": map[string]any{"city": "Kyiv"}, "spent": 40.0},
+			},
+		},
+		{
+			name: "single group",
+			pipeline: []Stage{
+				{Group: &GroupStage{Accumulators: map[string]Accumulator{"orders": {Op: AccumulatorCount}}}},
+			},
+			want: []map[string]any{{"orders": 5.0}},
+		},
+		{
+			name: "unwind and count items",
+			pipeline: []Stage{
+				{Unwind: "items"},
+				{Group: &GroupStage{By: []string{"items"}, Accumulators: map[string]Accumulator{"n": {Op: AccumulatorCount}}}},
+				{Sort: []SortField{{Field: "n", Desc: true}, {Field: "items"}}},
+			},
+			want: []map[string]any{
+				{"items": "pen", "n": 3.0},
+				{"items": "book", "n": 2.0},
+				{"items": "ink", "n": 1.0},
+			},
+		},
+		{
+			name: "sort, skip and project",
+			pipeline: []Stage{
+				{Sort: []SortField{{Field: "customer"}, {Field: "total", Desc: true}}},
+				{Skip: 1},
+				{Limit: 2},
+				{Project: &Projection{Include: []string{"id", "shipping.city", "missing"}}},
+			},
+			want: []map[string]any{
+				{"id": "3", "shipping": map[string]any{"city": "Lviv"}},
+				{"id": "5", "shipping": map[string]any{"city": "Kyiv"}},
+			},
+		},
+		{
+			name:     "match and project",
+			pipeline: []Stage{{Match: ptr(Eq("customer", "carol"))}, {Project: &Projection{Include: []string{"id"}}}},
+			want:     []map[string]any{{"id": "4"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := coll.Aggregate(tt.pipeline)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, plain(docs))
+		})
+	}
+
+	// Stages do not modify the stored documents.
+	doc, _ := coll.Get("1")
+	assert.Equal(t, []any{"pen", "ink"}, doc.Fields["items"].Value)
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestAggregate_IndexedMatch(t *testing.T) {
+	coll := setupOrdersCollection(t)
+	assert.NoError(t, coll.CreateIndex("customer"))
+	docs, err := coll.Aggregate([]Stage{
+		{Match: ptr(Eq("customer", "bob"))},
+		{Group: &GroupStage{Accumulators: map[string]Accumulator{"spent": {Op: AccumulatorSum, Field: "total"}}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"spent": 55.5}}, plain(docs))
+}
+
+func TestAggregate_Invalid(t *testing.T) {
+	coll := setupOrdersCollection(t)
+	tests := []struct {
+		name  string
+		stage Stage
+	}{
+		{name: "empty stage", stage: Stage{}},
+		{name: "two operations", stage: Stage{Limit: 1, Skip: 1}},
+		{name: "bad filter", stage: Stage{Match: &Filter{Op: "like"}}},
+		{name: "unknown accumulator", stage: Stage{Group: &GroupStage{Accumulators: map[string]Accumulator{"x": {Op: "median", Field: "total"}}}}},
+		{name: "accumulator without field", stage: Stage{Group: &GroupStage{Accumulators: map[string]Accumulator{"x": {Op: AccumulatorSum}}}}},
+		{name: "negative limit", stage: Stage{Limit: -1}},
+		{name: "empty sort", stage: Stage{Sort: []SortField{}}},
+		{name: "bad unwind path", stage: Stage{Unwind: "a..b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := coll.Aggregate([]Stage{tt.stage})
+			assert.ErrorIs(t, err, ErrInvalidQuery)
+		})
+	}
+}
+
+func TestStage_JSON(t *testing.T) {
+	var pipeline []Stage
+	err := json.Unmarshal([]byte(`[{"match":{"op":"eq","field":"customer","value":"bob"}},{"group":{"by":["customer"],"accumulators":{"n":{"op":"count"}}}},{"limit":1}]`), &pipeline)
+	assert.NoError(t, err)
+	assert.Equal(t, []Stage{
+		{Match: ptr(Eq("customer", "bob"))},
+		{Group: &GroupStage{By: []string{"customer"}, Accumulators: map[string]Accumulator{"n": {Op: AccumulatorCount}}}},
+		{Limit: 1},
+	}, pipeline)
+}
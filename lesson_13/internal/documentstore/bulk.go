@@ -0,0 +1,204 @@
+package documentstore
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// BulkOp is one operation of a Bulk call: a write of Document in Mode, or
+// the deletion of the document stored under Delete.
+type BulkOp struct {
+	Mode     WriteMode `json:"mode,omitempty"`   // defaults to upsert
+	Document *Document `json:"doc,omitempty"`    // document to write
+	Delete   string    `json:"delete,omitempty"` // key of the document to delete instead
+}
+
+// BulkOptions selects how Bulk handles failing operations. By default the
+// operations run in order and the first failure stops the call, keeping
+// the operations before it. Unordered runs every operation and reports
+// each failure. Atomic keeps none of the operations if any failed.
+type BulkOptions struct {
+	Unordered bool `json:"unordered,omitempty"`
+	Atomic    bool `json:"atomic,omitempty"`
+}
+
+// BulkResult counts the operations of a Bulk call that were kept.
+type BulkResult struct {
+	Created  int `json:"created"`
+	Replaced int `json:"replaced"`
+	Deleted  int `json:"deleted"`
+}
+
+// BulkError is the failure of the operation at Index of a Bulk call.
+type BulkError struct {
+	Index int
+	Err   error
+}
+
+func (e *BulkError) Error() string { return fmt.Sprintf("operation %d: %v", e.Index, e.Err) }
+func (e *BulkError) Unwrap() error { return e.Err }
+
+// PutMany upserts docs with Bulk.
+func (s *Collection) PutMany(docs []Document, opts BulkOptions) (BulkResult, error) {
+	ops := make([]BulkOp, len(docs))
+	for i := range docs {
+		ops[i] = BulkOp{Document: &docs[i]}
+	}
+	return s.Bulk(ops, opts)
+}
+
+// DeleteMany deletes the documents stored under keys with Bulk.
+func (s *Collection) DeleteMany(keys []string, opts BulkOptions) (BulkResult, error) {
+	ops := make([]BulkOp, len(keys))
+	for i, key := range keys {
+		ops[i] = BulkOp{Delete: key}
+	}
+	return s.Bulk(ops, opts)
+}
+
+// Bulk runs the operations under a single lock acquisition and journals
+// the ones kept as a single record, so loading many documents costs one
+// lock and one journal write. Every operation sees the ones before it.
+// The error joins a *BulkError for every failed operation; with Atomic, or
+// if the journal write fails, the result is empty and nothing is applied.
+func (s *Collection) Bulk(ops []BulkOp, opts BulkOptions) (BulkResult, error) {
+	// Primary keys are extracted before taking the lock.
+	keys := make([]string, len(ops))
+	errs := make([]error, len(ops))
+	for i, op := range ops {
+		switch {
+		case op.Document != nil && op.Delete != "":
+			errs[i] = fmt.Errorf("%w: an operation writes or deletes", ErrInvalidQuery)
+		case op.Document != nil:
+			keys[i], errs[i] = s.primaryKey(*op.Document)
+		case op.Delete != "":
+			keys[i] = op.Delete
+		default:
+			errs[i] = fmt.Errorf("%w: empty operation", ErrInvalidQuery)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := batch{c: s}
+	var res BulkResult
+	var failed []error
+	for i, op := range ops {
+		err := errs[i]
+		if err == nil {
+			err = s.bulkApply(&b, &res, keys[i], op)
+		}
+		if err == nil {
+			continue
+		}
+		failed = append(failed, &BulkError{Index: i, Err: err})
+		if !opts.Unordered {
+			break
+		}
+	}
+
+	if len(failed) > 0 && opts.Atomic {
+		b.rollback()
+		l.Error("bulk write error: rolled back", slog.Int("failed", len(failed)))
+		return BulkResult{}, errors.Join(failed...)
+	}
+	if err := b.commit(); err != nil {
+		l.Error("bulk write error: journal write failed", slog.String("error", err.Error()))
+		return BulkResult{}, err
+	}
+	l.Info("bulk write", slog.Int("created", res.Created), slog.Int("replaced", res.Replaced), slog.Int("deleted", res.Deleted), slog.Int("failed", len(failed)))
+	return res, errors.Join(failed...)
+}
+
+// bulkApply applies a single operation of Bulk to the batch.
+func (s *Collection) bulkApply(b *batch, res *BulkResult, pk string, op BulkOp) error {
+	if op.Document == nil {
+		if _, ok := s.documents[pk]; !ok {
+			return fmt.Errorf("%w: %s", ErrDocumentNotFound, pk)
+		}
+		b.delete(pk)
+		res.Deleted++
+		return nil
+	}
+
+	mode := op.Mode
+	if mode == "" {
+		mode = WriteUpsert
+	}
+	if err := s.checkWrite(pk, *op.Document, mode, nil); err != nil {
+		return err
+	}
+	if _, ok := s.documents[pk]; ok {
+		res.Replaced++
+	} else {
+		res.Created++
+	}
+	b.put(pk, *op.Document)
+	return nil
+}
+
+// batch applies writes to a collection whose lock the caller holds,
+// remembering how to undo them and collecting their journal records so
+// they are journaled as one.
+type batch struct {
+	c       *Collection
+	undo    []docEntry // previous documents, a nil Fields when there was none
+	records []journalRecord
+	events  []ChangeEvent
+}
+
+// put stores doc under pk with the next revision and returns it as stored.
+func (b *batch) put(pk string, doc Document) Document {
+	before := b.remember(pk)
+	doc.Revision = b.c.nextRevision()
+	b.c.applyPut(pk, doc)
+	b.records = append(b.records, journalRecord{Op: opPut, Collection: b.c.name, Document: &doc})
+	b.events = append(b.events, b.c.change(pk, before, &doc))
+	return doc
+}
+
+func (b *batch) delete(pk string) {
+	before := b.remember(pk)
+	b.c.applyDelete(pk)
+	b.records = append(b.records, journalRecord{Op: opDelete, Collection: b.c.name, Key: pk})
+	b.events = append(b.events, b.c.change(pk, before, nil))
+}
+
+// remember records the document stored under pk to undo a write and
+// returns it, nil if there is none.
+func (b *batch) remember(pk string) *Document {
+	doc, ok := b.c.documents[pk]
+	b.undo = append(b.undo, docEntry{pk: pk, doc: doc})
+	if !ok {
+		return nil
+	}
+	return &doc
+}
+
+// rollback undoes the writes in reverse order.
+func (b *batch) rollback() {
+	for i := len(b.undo) - 1; i >= 0; i-- {
+		if u := b.undo[i]; u.doc.Fields == nil {
+			b.c.applyDelete(u.pk)
+		} else {
+			b.c.applyPut(u.pk, u.doc)
+		}
+	}
+	b.undo, b.records, b.events = nil, nil, nil
+}
+
+// commit journals the writes as a single record, rolling them back if that
+// fails, and then streams their changes.
+func (b *batch) commit() error {
+	if len(b.records) == 0 {
+		return nil
+	}
+	if err := b.c.log(&journalRecord{Op: opTransaction, Ops: b.records}); err != nil {
+		b.rollback()
+		return err
+	}
+	b.c.publish(b.events)
+	return nil
+}
@@ -0,0 +1,146 @@
+package documentstore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bulkErrorIndexes(t *testing.T, err error) []int {
+	var indexes []int
+	if err == nil {
+		return indexes
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("not a joined error: %v", err)
+	}
+	for _, e := range joined.Unwrap() {
+		var bulkErr *BulkError
+		if !errors.As(e, &bulkErr) {
+			t.Fatalf("not a BulkError: %v", e)
+		}
+		indexes = append(indexes, bulkErr.Index)
+	}
+	return indexes
+}
+
+func TestCollection_Bulk(t *testing.T) {
+	alicia, carol, dave := userDoc("1", "Alicia"), userDoc("3", "Carol"), userDoc("4", "Dave")
+	noKey := Document{Fields: map[string]DocumentField{}}
+	ops := []BulkOp{
+		{Mode: WriteReplace, Document: &alicia},
+		{Mode: WriteInsert, Document: &carol},
+		{Mode: WriteInsert, Document: &alicia}, // exists
+		{Delete: "2"},
+		{Delete: "2"}, // deleted by the previous op
+		{Document: &noKey},
+		{Document: &dave},
+	}
+
+	tests := []struct {
+		name        string
+		opts        BulkOptions
+		want        BulkResult
+		wantFailed  []int
+		wantIDs     []string
+		wantNameOf1 string
+	}{
+		{
+			name:        "ordered stops at the first failure",
+			want:        BulkResult{Created: 1, Replaced: 1},
+			wantFailed:  []int{2},
+			wantIDs:     []string{"1", "2", "3"},
+			wantNameOf1: "Alicia",
+		},
+		{
+			name:        "unordered runs every operation",
+			opts:        BulkOptions{Unordered: true},
+			want:        BulkResult{Created: 2, Replaced: 1, Deleted: 1},
+			wantFailed:  []int{2, 4, 5},
+			wantIDs:     []string{"1", "3", "4"},
+			wantNameOf1: "Alicia",
+		},
+		{
+			name:        "atomic keeps nothing",
+			opts:        BulkOptions{Atomic: true},
+			wantFailed:  []int{2},
+			wantIDs:     []string{"1", "2"},
+			wantNameOf1: "Alice",
+		},
+		{
+			name:        "atomic unordered reports every failure",
+			opts:        BulkOptions{Atomic: true, Unordered: true},
+			wantFailed:  []int{2, 4, 5},
+			wantIDs:     []string{"1", "2"},
+			wantNameOf1: "Alice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore()
+			active, _ := setupAccounts(t, store)
+			assert.NoError(t, active.CreateIndex("name"))
+
+			got, err := active.Bulk(ops, tt.opts)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantFailed, bulkErrorIndexes(t, err))
+			assert.Equal(t, tt.wantIDs, pageIDs(active.List()))
+			doc, _ := active.Get("1")
+			assert.Equal(t, tt.wantNameOf1, doc.Fields["name"].Value)
+
+			// The index follows the documents kept.
+			docs, err := active.Query("name", QueryParams{})
+			assert.NoError(t, err)
+			assert.Len(t, docs, len(tt.wantIDs))
+		})
+	}
+}
+
+func TestCollection_PutManyDeleteMany(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, users.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "name"}}, Unique: true}))
+
+	docs := make([]Document, 100)
+	keys := make([]string, 0, 50)
+	for i := range docs {
+		docs[i] = userDoc(fmt.Sprintf("%03d", i), fmt.Sprintf("user%d", i))
+		if i%2 == 0 {
+			keys = append(keys, fmt.Sprintf("%03d", i))
+		}
+	}
+	res, err := users.PutMany(docs, BulkOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, BulkResult{Created: 100}, res)
+
+	res, err = users.DeleteMany(append(keys, "missing"), BulkOptions{Unordered: true})
+	assert.Equal(t, []int{50}, bulkErrorIndexes(t, err))
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+	assert.Equal(t, BulkResult{Deleted: 50}, res)
+
+	// A unique index violation within the batch.
+	res, err = users.PutMany([]Document{userDoc("a", "dup"), userDoc("b", "dup")}, BulkOptions{Atomic: true})
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+	assert.Equal(t, BulkResult{}, res)
+	assert.NoError(t, store.Close())
+
+	restored, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer restored.Close()
+	users, _ = restored.GetCollection("users")
+	assert.Len(t, users.List(), 50)
+	doc, err := users.Get("001")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), doc.Revision)
+	_, err = users.Get("a")
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+}
@@ -0,0 +1,186 @@
+package documentstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fillUsers(t *testing.T, col *Collection, from, to int) {
+	for i := from; i < to; i++ {
+		id := fmt.Sprint(i)
+		assert.NoError(t, col.Put(userDoc(id, "user"+id)))
+	}
+}
+
+func openUsers(t *testing.T, dir string, opts *StoreOptions) (*Store, *Collection) {
+	store, err := OpenStore(dir, opts)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	col, err := store.GetCollection("users")
+	if err != nil {
+		col, err = store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+		if err != nil {
+			t.Fatalf("CreateCollection() error = %v", err)
+		}
+	}
+	return store, col
+}
+
+func TestStore_Checkpoint(t *testing.T) {
+	dir := t.TempDir()
+	store, users := openUsers(t, dir, nil)
+	fillUsers(t, users, 0, 10)
+	assert.NoError(t, users.CreateIndex("name"))
+	assert.NoError(t, store.Checkpoint())
+	assert.NoError(t, users.Delete("0"))
+	fillUsers(t, users, 10, 15)
+	assert.NoError(t, store.Checkpoint())
+	fillUsers(t, users, 15, 20)
+	assert.NoError(t, store.Close())
+
+	segments, _ := journalSegments(dir)
+	assert.Len(t, segments, 1)
+	snapshots, _ := snapshotFiles(dir)
+	assert.Len(t, snapshots, 1)
+
+	restored, col := openUsers(t, dir, nil)
+	defer restored.Close()
+	assert.Len(t, col.List(), 19)
+	_, err := col.Get("0")
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+	docs, err := col.Query("name", QueryParams{})
+	assert.NoError(t, err)
+	assert.Len(t, docs, 19)
+}
+
+func TestStore_Checkpoint_CrashBeforeRename(t *testing.T) {
+	dir := t.TempDir()
+	store, users := openUsers(t, dir, nil)
+	fillUsers(t, users, 0, 10)
+
+	// Die half way through writing the snapshot.
+	lsn, data, err := store.prepareCheckpoint()
+	assert.NoError(t, err)
+	tmp := filepath.Join(dir, snapshotFileName(lsn)) + tempFileSuffix
+	assert.NoError(t, os.WriteFile(tmp, data[:len(data)/2], 0644))
+	f, err := os.CreateTemp(dir, snapshotFileName(lsn)+".*"+tempFileSuffix)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	fillUsers(t, users, 10, 12)
+	assert.NoError(t, store.journal.close())
+
+	// Temporary files the store did not write are kept.
+	notes := filepath.Join(dir, "notes"+tempFileSuffix)
+	assert.NoError(t, os.WriteFile(notes, []byte("keep"), 0644))
+
+	restored, col := openUsers(t, dir, nil)
+	defer restored.Close()
+	assert.Len(t, col.List(), 12)
+	_, err = os.Stat(tmp)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(f.Name())
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(notes)
+	assert.NoError(t, err)
+}
+
+func TestStore_Checkpoint_CrashDuringRotation(t *testing.T) {
+	dir := t.TempDir()
+	store, users := openUsers(t, dir, &StoreOptions{Sync: SyncNever})
+	fillUsers(t, users, 0, 10)
+
+	// Whatever point of the rotation a crash hits, the unsynced segment is
+	// still the last one, where a torn record is recovered from.
+	var segmentsAtSync []int
+	syncFile = func(f *os.File) error {
+		segments, _ := journalSegments(dir)
+		segmentsAtSync = append(segmentsAtSync, len(segments))
+		return f.Sync()
+	}
+	defer func() { syncFile = (*os.File).Sync }()
+	_, err := store.journal.rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, segmentsAtSync)
+
+	fillUsers(t, users, 10, 12)
+	assert.NoError(t, store.Close())
+	segments, _ := journalSegments(dir)
+	assert.Len(t, segments, 2)
+	restored, col := openUsers(t, dir, nil)
+	defer restored.Close()
+	assert.Len(t, col.List(), 12)
+}
+
+func TestStore_Checkpoint_CorruptNewestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store, users := openUsers(t, dir, nil)
+	fillUsers(t, users, 0, 5)
+	assert.NoError(t, store.Checkpoint())
+	fillUsers(t, users, 5, 10)
+
+	// Die after the new snapshot was renamed into place but before the journal
+	// was compacted, and lose the end of the snapshot on the way.
+	lsn, data, err := store.prepareCheckpoint()
+	assert.NoError(t, err)
+	assert.NoError(t, writeSnapshot(dir, lsn, data))
+	fillUsers(t, users, 10, 12)
+	assert.NoError(t, store.journal.close())
+
+	path := filepath.Join(dir, snapshotFileName(lsn))
+	info, _ := os.Stat(path)
+	assert.NoError(t, os.Truncate(path, info.Size()-10))
+
+	restored, col := openUsers(t, dir, nil)
+	defer restored.Close()
+	assert.Len(t, col.List(), 12)
+}
+
+func TestStore_Checkpoint_MissingJournal(t *testing.T) {
+	dir := t.TempDir()
+	store, users := openUsers(t, dir, nil)
+	fillUsers(t, users, 0, 5)
+	assert.NoError(t, store.Checkpoint())
+	fillUsers(t, users, 5, 10)
+	assert.NoError(t, store.Checkpoint())
+	assert.NoError(t, store.Close())
+
+	// The only snapshot is unusable and the journal it replaced is gone, so
+	// the state cannot be rebuilt.
+	snapshots, _ := snapshotFiles(dir)
+	assert.Len(t, snapshots, 1)
+	assert.NoError(t, os.WriteFile(snapshots[0].path, []byte("garbage"), 0644))
+
+	_, err := OpenStore(dir, nil)
+	assert.ErrorIs(t, err, ErrJournalCorrupt)
+}
+
+func TestStore_Checkpoint_Automatic(t *testing.T) {
+	dir := t.TempDir()
+	store, users := openUsers(t, dir, &StoreOptions{CheckpointEvery: 5})
+	fillUsers(t, users, 0, 20)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		snapshots, _ := snapshotFiles(dir)
+		if len(snapshots) > 0 || time.Now().After(deadline) {
+			assert.NotEmpty(t, snapshots)
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, store.Close())
+
+	restored, col := openUsers(t, dir, nil)
+	defer restored.Close()
+	assert.Len(t, col.List(), 20)
+}
+
+func TestStore_Checkpoint_NotPersistent(t *testing.T) {
+	assert.ErrorIs(t, NewStore().Checkpoint(), ErrStoreNotPersistent)
+}
@@ -2,17 +2,37 @@ package documentstore
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 
 	"github.com/google/btree"
 )
 
 type Collection struct {
-	cfg       CollectionConfig
-	documents map[string]Document
-	indexes   map[string]*btree.BTreeG[*indexItem]
-	mu        sync.RWMutex
+	name        string
+	store       *Store // owning store, nil once the collection is deleted
+	cfg         CollectionConfig
+	documents   map[string]Document
+	indexes     map[string]*index
+	textIndexes map[string]*textIndex
+	mu          sync.RWMutex
+
+	// revision is the highest revision handed out, see Document. It only
+	// goes up, deletes included, so a revision is never handed out twice.
+	revision uint64
+
+	// primary mirrors documents in primary key order for snapshots; it is
+	// built by the first one. snap caches the latest snapshot until the
+	// next write. Both are guarded by snapMu under the read lock, or by
+	// the write lock.
+	primary *btree.BTreeG[*docEntry]
+	snap    *Snapshot
+	snapMu  sync.Mutex
+
+	// feed streams the changes of a collection outside a store, see Watch.
+	feed atomic.Pointer[changeFeed]
 }
 
 type CollectionConfig struct {
@@ -26,58 +46,214 @@ var (
 	ErrDocumentEmptyPrimaryKey = errors.New("primary key value cannot be empty")
 	ErrIndexExists             = errors.New("index already exists")
 	ErrIndexNotFound           = errors.New("index not found")
+	ErrRevisionConflict        = errors.New("document revision conflict")
+	ErrDocumentExists          = errors.New("document already exists")
 )
 
-type indexItem struct {
-	key string
-	pk  string // primary key
+func (s *Collection) Put(doc Document) error {
+	_, err := s.put(doc, WriteUpsert, nil)
+	return err
 }
 
-func (s *Collection) Put(doc Document) error {
+// PutIfRevision stores doc like Put, but only if the document it replaces
+// is at the given revision; otherwise it fails with ErrRevisionConflict. A
+// revision of 0 stands for no document, so it only lets doc be created.
+func (s *Collection) PutIfRevision(doc Document, revision uint64) error {
+	_, err := s.put(doc, WriteUpsert, &revision)
+	return err
+}
+
+// WriteMode selects what a write does depending on whether a document with
+// the same primary key is already stored.
+type WriteMode string
+
+const (
+	WriteUpsert  WriteMode = "upsert"  // create or replace
+	WriteInsert  WriteMode = "insert"  // create only, ErrDocumentExists otherwise
+	WriteReplace WriteMode = "replace" // replace only, ErrDocumentNotFound otherwise
+)
+
+// Insert stores doc if no document has its primary key and fails with
+// ErrDocumentExists otherwise.
+func (s *Collection) Insert(doc Document) error {
+	_, err := s.put(doc, WriteInsert, nil)
+	return err
+}
+
+// Replace stores doc in place of the document with its primary key and
+// fails with ErrDocumentNotFound if there is none.
+func (s *Collection) Replace(doc Document) error {
+	_, err := s.put(doc, WriteReplace, nil)
+	return err
+}
+
+// Upsert is Put reporting whether doc was created rather than replacing a
+// document.
+func (s *Collection) Upsert(doc Document) (created bool, err error) {
+	return s.put(doc, WriteUpsert, nil)
+}
+
+// Write stores doc in the given mode, only if the document it replaces is
+// at revision when that is not nil, and reports whether doc was created.
+func (s *Collection) Write(doc Document, mode WriteMode, revision *uint64) (created bool, err error) {
+	return s.put(doc, mode, revision)
+}
+
+func (s *Collection) put(doc Document, mode WriteMode, revision *uint64) (bool, error) {
+	pk, err := s.primaryKey(doc)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, exists := s.documents[pk]
+	if err := s.checkWrite(pk, doc, mode, revision); err != nil {
+		return false, err
+	}
+	doc.Revision = s.nextRevision()
+	if err := s.log(&journalRecord{Op: opPut, Document: &doc}); err != nil {
+		l.Error("document creation error: journal write failed", slog.Any("PrimaryKey", pk), slog.String("error", err.Error()))
+		return false, err
+	}
+	s.applyPut(pk, doc)
+	if exists {
+		s.publish([]ChangeEvent{s.change(pk, &prev, &doc)})
+	} else {
+		s.publish([]ChangeEvent{s.change(pk, nil, &doc)})
+	}
+
+	if exists {
+		l.Info("document replaced", slog.Any("PrimaryKey", pk))
+	} else {
+		l.Info("document created", slog.Any("PrimaryKey", pk))
+	}
+	return !exists, nil
+}
+
+// checkWrite fails if doc cannot be stored under pk in the given mode, at
+// the given revision if not nil. The caller must hold the lock.
+func (s *Collection) checkWrite(pk string, doc Document, mode WriteMode, revision *uint64) error {
+	_, exists := s.documents[pk]
+	switch mode {
+	case WriteUpsert:
+	case WriteInsert:
+		if exists {
+			l.Error("document creation error: document already exists", slog.Any("PrimaryKey", pk))
+			return fmt.Errorf("%w: %s", ErrDocumentExists, pk)
+		}
+	case WriteReplace:
+		if !exists {
+			l.Error("document creation error: document not found", slog.Any("PrimaryKey", pk))
+			return fmt.Errorf("%w: %s", ErrDocumentNotFound, pk)
+		}
+	default:
+		return fmt.Errorf("%w: unknown write mode %q", ErrInvalidQuery, mode)
+	}
+	if revision != nil {
+		if err := s.checkRevision(pk, *revision); err != nil {
+			l.Error("document creation error: revision conflict", slog.Any("PrimaryKey", pk), slog.String("error", err.Error()))
+			return err
+		}
+	}
+	if err := s.checkUnique(pk, doc); err != nil {
+		l.Error("document creation error: unique index violated", slog.Any("PrimaryKey", pk), slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// checkRevision fails with ErrRevisionConflict unless the document stored
+// under pk is at revision, 0 meaning there is none. The caller must hold
+// the lock.
+func (s *Collection) checkRevision(pk string, revision uint64) error {
+	doc, ok := s.documents[pk]
+	switch {
+	case !ok && revision != 0:
+		return fmt.Errorf("%w: document %q does not exist", ErrRevisionConflict, pk)
+	case ok && (revision == 0 || doc.Revision != revision):
+		return fmt.Errorf("%w: document %q is at revision %d", ErrRevisionConflict, pk, doc.Revision)
+	}
+	return nil
+}
+
+// nextRevision returns the revision of the next document put. The caller
+// must hold the lock.
+func (s *Collection) nextRevision() uint64 {
+	return s.revision + 1
+}
+
+// primaryKey extracts and validates the primary key of doc.
+func (s *Collection) primaryKey(doc Document) (string, error) {
 	key, ok := doc.Fields[s.cfg.PrimaryKey]
 	if !ok || key.Type != DocumentFieldTypeString {
 		l.Error("document creation error: document with no primary key", slog.Any("document", doc))
-		return ErrDocumentNoPrimaryKey
+		return "", ErrDocumentNoPrimaryKey
 	}
 
 	pk, ok := key.Value.(string)
 	if !ok {
 		l.Error("document creation error: document with invalid primary key", slog.Any("PrimaryKey", key))
-		return ErrDocumentInvalidKeyType
+		return "", ErrDocumentInvalidKeyType
 	}
 	if pk == "" {
 		l.Error("document creation error: document with empty key", slog.Any("document", doc))
-		return ErrDocumentEmptyPrimaryKey
+		return "", ErrDocumentEmptyPrimaryKey
 	}
+	return pk, nil
+}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	oldDoc, existed := s.documents[pk]
-	if existed && s.indexes != nil {
-		for field, tree := range s.indexes {
-			if oldField, ok := oldDoc.Fields[field]; ok && oldField.Type == DocumentFieldTypeString {
-				if strVal, ok := oldField.Value.(string); ok {
-					tree.Delete(&indexItem{key: strVal, pk: pk})
-				}
+// checkUnique fails with ErrDuplicateKey if storing doc under pk would give
+// a unique index two documents with the same key. The caller must hold the
+// lock.
+func (s *Collection) checkUnique(pk string, doc Document) error {
+	for name, idx := range s.indexes {
+		if !idx.cfg.Unique {
+			continue
+		}
+		for _, keys := range idx.keys(doc) {
+			if other, ok := idx.conflict(pk, keys); ok {
+				return fmt.Errorf("%w: index %q already holds document %q", ErrDuplicateKey, name, other)
 			}
 		}
 	}
+	return nil
+}
+
+// applyPut stores doc under pk and keeps the indexes in sync. The caller
+// must hold the write lock.
+func (s *Collection) applyPut(pk string, doc Document) {
+	for _, idx := range s.indexes {
+		idx.remove(pk)
+	}
+	for _, idx := range s.textIndexes {
+		idx.remove(pk)
+	}
 
 	s.documents[pk] = doc
+	s.revision = max(s.revision, doc.Revision)
+	if s.primary != nil {
+		s.primary.ReplaceOrInsert(&docEntry{pk: pk, doc: doc})
+	}
+	s.snap = nil
 
-	if s.indexes != nil {
-		for field, tree := range s.indexes {
-			if newField, ok := doc.Fields[field]; ok && newField.Type == DocumentFieldTypeString {
-				if strVal, ok := newField.Value.(string); ok {
-					tree.ReplaceOrInsert(&indexItem{key: strVal, pk: pk})
-				}
-			}
-		}
+	for _, idx := range s.indexes {
+		idx.insert(pk, doc)
 	}
+	for _, idx := range s.textIndexes {
+		idx.insert(pk, doc)
+	}
+}
 
-	l.Info("document created", slog.Any("PrimaryKey", key))
-	return nil
+// log appends rec to the journal of the owning store, if any. The caller
+// must hold the write lock.
+func (s *Collection) log(rec *journalRecord) error {
+	if s.store == nil {
+		return nil
+	}
+	rec.Collection = s.name
+	return s.store.log(rec)
 }
 
 func (s *Collection) Get(key string) (*Document, error) {
@@ -90,7 +266,34 @@ func (s *Collection) Get(key string) (*Document, error) {
 	return nil, ErrDocumentNotFound
 }
 
+// GetProjected is Get returning only the fields selected by projection.
+func (s *Collection) GetProjected(key string, projection Projection) (*Document, error) {
+	if err := projection.validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if doc, ok := s.documents[key]; ok {
+		doc = projection.apply(doc, s.cfg.PrimaryKey)
+		return &doc, nil
+	}
+	return nil, ErrDocumentNotFound
+}
+
 func (s *Collection) Delete(key string) error {
+	return s.delete(key, nil)
+}
+
+// DeleteIfRevision deletes the document stored under key like Delete, but
+// only if it is at the given revision; otherwise it fails with
+// ErrRevisionConflict.
+func (s *Collection) DeleteIfRevision(key string, revision uint64) error {
+	return s.delete(key, &revision)
+}
+
+func (s *Collection) delete(key string, revision *uint64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -99,125 +302,236 @@ func (s *Collection) Delete(key string) error {
 		l.Error("document deletion error: document not found", slog.Any("PrimaryKey", key))
 		return ErrDocumentNotFound
 	}
-	if s.indexes != nil {
-		for field, tree := range s.indexes {
-			if fieldVal, ok := doc.Fields[field]; ok && fieldVal.Type == DocumentFieldTypeString {
-				if strVal, ok := fieldVal.Value.(string); ok {
-					tree.Delete(&indexItem{key: strVal, pk: key})
-				}
-			}
-		}
+	if revision != nil && doc.Revision != *revision {
+		l.Error("document deletion error: revision conflict", slog.Any("PrimaryKey", key), slog.Uint64("revision", doc.Revision))
+		return fmt.Errorf("%w: document %q is at revision %d", ErrRevisionConflict, key, doc.Revision)
 	}
-	delete(s.documents, key)
+	if err := s.log(&journalRecord{Op: opDelete, Key: key}); err != nil {
+		l.Error("document deletion error: journal write failed", slog.Any("PrimaryKey", key), slog.String("error", err.Error()))
+		return err
+	}
+	s.applyDelete(key)
+	s.publish([]ChangeEvent{s.change(key, &doc, nil)})
 	return nil
 }
 
-func (s *Collection) List() []Document {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	documents := make([]Document, 0, len(s.documents))
-	for _, doc := range s.documents {
-		documents = append(documents, doc)
+// applyDelete removes the document stored under key together with its index
+// entries. The caller must hold the write lock.
+func (s *Collection) applyDelete(key string) {
+	if _, ok := s.documents[key]; !ok {
+		return
+	}
+	for _, idx := range s.indexes {
+		idx.remove(key)
+	}
+	for _, idx := range s.textIndexes {
+		idx.remove(key)
+	}
+	delete(s.documents, key)
+	if s.primary != nil {
+		s.primary.Delete(&docEntry{pk: key})
 	}
-	return documents
+	s.snap = nil
 }
 
-func (a *indexItem) Less(b *indexItem) bool {
-	return a.key < b.key || (a.key == b.key && a.pk < b.pk)
+// List returns all documents in primary key order.
+func (s *Collection) List() []Document {
+	return s.Snapshot().List()
 }
 
+// CreateIndex creates an ascending index over a single field, named after
+// the field. The field may be a dotted path into nested objects, see
+// Document.Lookup.
 func (s *Collection) CreateIndex(fieldName string) error {
+	return s.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: fieldName}}})
+}
+
+// CreateIndexWithConfig creates an index over an ordered list of fields.
+// Creating a unique index fails with ErrDuplicateKey if the existing
+// documents already violate it.
+func (s *Collection) CreateIndexWithConfig(cfg IndexConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.indexes == nil {
-		s.indexes = make(map[string]*btree.BTreeG[*indexItem])
-	}
-	if _, exists := s.indexes[fieldName]; exists {
+	if s.hasIndex(cfg.name()) {
 		return ErrIndexExists
 	}
-	tree := btree.NewG(8, func(a, b *indexItem) bool { return a.Less(b) })
+	idx, err := s.buildIndex(cfg)
+	if err != nil {
+		return err
+	}
+	if err := s.log(&journalRecord{Op: opCreateIndex, IndexConfig: &cfg}); err != nil {
+		return err
+	}
+	s.addIndex(idx)
+	return nil
+}
+
+// applyCreateIndex builds the index over the existing documents and adds it
+// to the collection. The caller must hold the write lock.
+func (s *Collection) applyCreateIndex(cfg IndexConfig) error {
+	idx, err := s.buildIndex(cfg)
+	if err != nil {
+		return err
+	}
+	s.addIndex(idx)
+	return nil
+}
+
+// buildIndex indexes the existing documents, checking the unique constraint
+// if the index has one. The caller must hold the lock.
+func (s *Collection) buildIndex(cfg IndexConfig) (*index, error) {
+	idx := newIndex(cfg)
 	for pk, doc := range s.documents {
-		field, ok := doc.Fields[fieldName]
-		if !ok || field.Type != DocumentFieldTypeString {
-			continue
-		}
-		strVal, ok := field.Value.(string)
-		if !ok {
-			continue
+		if cfg.Unique {
+			for _, keys := range idx.keys(doc) {
+				if other, ok := idx.conflict(pk, keys); ok {
+					return nil, fmt.Errorf("%w: documents %q and %q have the same key", ErrDuplicateKey, other, pk)
+				}
+			}
 		}
-		tree.ReplaceOrInsert(&indexItem{key: strVal, pk: pk})
+		idx.insert(pk, doc)
+	}
+	return idx, nil
+}
+
+func (s *Collection) addIndex(idx *index) {
+	if s.indexes == nil {
+		s.indexes = make(map[string]*index)
 	}
-	s.indexes[fieldName] = tree
+	s.indexes[idx.cfg.name()] = idx
+	s.snap = nil
+}
+
+// hasIndex reports whether an index or a text index has the given name.
+// The caller must hold the lock.
+func (s *Collection) hasIndex(name string) bool {
+	_, isIndex := s.indexes[name]
+	_, isText := s.textIndexes[name]
+	return isIndex || isText
+}
+
+// CreateTextIndex creates a full-text index searchable with Search.
+func (s *Collection) CreateTextIndex(cfg TextIndexConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasIndex(cfg.name()) {
+		return ErrIndexExists
+	}
+	if err := s.log(&journalRecord{Op: opCreateTextIndex, TextIndex: &cfg}); err != nil {
+		return err
+	}
+	s.applyCreateTextIndex(cfg)
 	return nil
 }
 
+// applyCreateTextIndex builds the text index over the existing documents.
+// The caller must hold the write lock and have validated cfg.
+func (s *Collection) applyCreateTextIndex(cfg TextIndexConfig) {
+	idx := newTextIndex(cfg)
+	for pk, doc := range s.documents {
+		idx.insert(pk, doc)
+	}
+	if s.textIndexes == nil {
+		s.textIndexes = make(map[string]*textIndex)
+	}
+	s.textIndexes[cfg.name()] = idx
+}
+
+// DeleteIndex removes the index or text index with the given name.
 func (s *Collection) DeleteIndex(fieldName string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.indexes == nil {
+	if !s.hasIndex(fieldName) {
 		return ErrIndexNotFound
 	}
-	if _, exists := s.indexes[fieldName]; !exists {
-		return ErrIndexNotFound
+	if err := s.log(&journalRecord{Op: opDeleteIndex, Index: fieldName}); err != nil {
+		return err
 	}
-	delete(s.indexes, fieldName)
+	s.applyDeleteIndex(fieldName)
 	return nil
 }
 
+// applyDeleteIndex removes an index of either kind. The caller must hold
+// the write lock.
+func (s *Collection) applyDeleteIndex(name string) {
+	delete(s.indexes, name)
+	delete(s.textIndexes, name)
+	s.snap = nil
+}
+
+// QueryParams selects a range of an index. Prefix holds values the leading
+// fields of a compound index must be equal to; MinValue and MaxValue bound
+// the field that follows. The bounds are inclusive unless MinExclusive or
+// MaxExclusive is set and may be strings, numbers of any Go numeric type,
+// bools or pointers to them. A single bound only matches keys of its own
+// type, so MinValue 10 returns the numbers from 10 up and no strings.
+// StartsWith instead selects the strings beginning with it and cannot be
+// combined with bounds.
+//
+// Skip and Limit page through the range; a Limit of 0 means no limit. Cursor
+// resumes after the last document of a previous page, see QueryPage.
 type QueryParams struct {
 	Desc     bool
-	MinValue *string
-	MaxValue *string
+	Prefix   []any
+	MinValue any
+	MaxValue any
+
+	MinExclusive bool
+	MaxExclusive bool
+	StartsWith   string
+
+	Skip   int
+	Limit  int
+	Cursor string
+
+	Sort       []SortField // order by these fields, then by primary key
+	Projection *Projection // nil returns whole documents
+}
+
+// Query returns the documents in the given range of the named index, in
+// index order.
+func (s *Collection) Query(indexName string, params QueryParams) ([]Document, error) {
+	return s.Snapshot().Query(indexName, params)
 }
 
-func (s *Collection) Query(fieldName string, params QueryParams) ([]Document, error) {
+// Query is Collection.Query on the snapshot.
+func (sn *Snapshot) Query(indexName string, params QueryParams) ([]Document, error) {
+	page, err := sn.QueryPage(indexName, params)
+	if err != nil {
+		return nil, err
+	}
+	return page.Documents, nil
+}
+
+// Search returns the documents of the named text index matching any term of
+// query, ranked by BM25 relevance. A positive limit caps the number of
+// results.
+func (s *Collection) Search(indexName string, query string, limit int) ([]SearchResult, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if s.indexes == nil {
-		return nil, ErrIndexNotFound
-	}
-	tree, ok := s.indexes[fieldName]
+	idx, ok := s.textIndexes[indexName]
 	if !ok {
 		return nil, ErrIndexNotFound
 	}
-	var result []Document
-	visit := func(item *indexItem) bool {
-		doc := s.documents[item.pk]
-		result = append(result, doc)
-		return true
-	}
-
-	var minValue, maxValue string
-	if params.MinValue != nil {
-		minValue = *params.MinValue
-	}
-	if params.MaxValue != nil {
-		maxValue = *params.MaxValue
+	pks, scores := idx.search(query)
+	if limit > 0 && len(pks) > limit {
+		pks = pks[:limit]
 	}
-	if params.Desc {
-		tree.Descend(func(item *indexItem) bool {
-			if params.MinValue != nil && item.key < minValue {
-				return false
-			}
-			if params.MaxValue != nil && item.key > maxValue {
-				return true
-			}
-			return visit(item)
-		})
-	} else {
-		tree.Ascend(func(item *indexItem) bool {
-			if params.MinValue != nil && item.key < minValue {
-				return true
-			}
-			if params.MaxValue != nil && item.key > maxValue {
-				return false
-			}
-			return visit(item)
-		})
+	results := make([]SearchResult, len(pks))
+	for i, pk := range pks {
+		results[i] = SearchResult{Document: s.documents[pk], Score: scores[pk]}
 	}
-	return result, nil
+	return results, nil
 }
@@ -93,6 +93,63 @@ func TestCollection_Put(t *testing.T) {
 	}
 }
 
+func TestCollection_WriteModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		write       func(c *Collection, doc Document) (bool, error)
+		exists      bool
+		wantCreated bool
+		wantErr     error
+	}{
+		{name: "insert new", write: insertCreated, wantCreated: true},
+		{name: "insert existing", write: insertCreated, exists: true, wantErr: ErrDocumentExists},
+		{name: "replace existing", write: replaceCreated, exists: true},
+		{name: "replace missing", write: replaceCreated, wantErr: ErrDocumentNotFound},
+		{name: "upsert new", write: (*Collection).Upsert, wantCreated: true},
+		{name: "upsert existing", write: (*Collection).Upsert, exists: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+			if tt.exists {
+				assert.NoError(t, c.Put(userDoc("1", "Alice")))
+			}
+
+			created, err := tt.write(c, userDoc("1", "Alicia"))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				if tt.exists {
+					doc, _ := c.Get("1")
+					assert.Equal(t, "Alice", doc.Fields["name"].Value)
+				} else {
+					assert.Empty(t, c.List())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCreated, created)
+			doc, _ := c.Get("1")
+			assert.Equal(t, "Alicia", doc.Fields["name"].Value)
+		})
+	}
+
+	c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+	_, err := c.Write(userDoc("1", "Alice"), "merge", nil)
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	assert.NoError(t, c.Insert(userDoc("1", "Alice")))
+	rev := uint64(2)
+	_, err = c.Write(userDoc("1", "Alicia"), WriteReplace, &rev)
+	assert.ErrorIs(t, err, ErrRevisionConflict)
+}
+
+func insertCreated(c *Collection, doc Document) (bool, error) {
+	return true, c.Insert(doc)
+}
+
+func replaceCreated(c *Collection, doc Document) (bool, error) {
+	return false, c.Replace(doc)
+}
+
 func TestCollection_Get(t *testing.T) {
 	type fields struct {
 		cfg       CollectionConfig
@@ -427,10 +484,10 @@ func TestCreateIndex_Success(t *testing.T) {
 	// Попробуем создать новый индекс по несуществующему полю
 	err := coll.CreateIndex("nonexistent")
 	assert.NoError(t, err)
-	tree, ok := coll.indexes["nonexistent"]
+	idx, ok := coll.indexes["nonexistent"]
 	assert.True(t, ok)
 	count := 0
-	tree.Ascend(func(item *indexItem) bool {
+	idx.tree.Ascend(func(item *indexItem) bool {
 		count++
 		return true
 	})
@@ -443,7 +500,7 @@ func TestCreateIndex_AlreadyExists(t *testing.T) {
 	assert.ErrorIs(t, err, ErrIndexExists)
 }
 
-func TestCreateIndex_NonStringField(t *testing.T) {
+func TestCreateIndex_NumberField(t *testing.T) {
 	coll := setupTestCollection()
 	coll.documents["4"] = Document{Fields: map[string]DocumentField{
 		"id":  {Type: DocumentFieldTypeString, Value: "4"},
@@ -451,14 +508,15 @@ func TestCreateIndex_NonStringField(t *testing.T) {
 	}}
 	err := coll.CreateIndex("age")
 	assert.NoError(t, err)
-	tree, ok := coll.indexes["age"]
+	idx, ok := coll.indexes["age"]
 	assert.True(t, ok)
 	count := 0
-	tree.Ascend(func(item *indexItem) bool {
+	idx.tree.Ascend(func(item *indexItem) bool {
 		count++
 		return true
 	})
-	assert.Equal(t, 0, count)
+	// Number fields are indexed, the documents without "age" are not.
+	assert.Equal(t, 1, count)
 }
 
 func TestDeleteIndex_Success(t *testing.T) {
@@ -474,3 +532,74 @@ func TestDeleteIndex_NotFound(t *testing.T) {
 	err := coll.DeleteIndex("notfound")
 	assert.ErrorIs(t, err, ErrIndexNotFound)
 }
+
+func setupTypedCollection() *Collection {
+	coll := &Collection{
+		cfg:       CollectionConfig{PrimaryKey: "id"},
+		documents: map[string]Document{},
+	}
+	docs := []map[string]any{
+		{"id": "1", "price": 9.5, "active": true},
+		{"id": "2", "price": 100, "active": false},
+		{"id": "3", "price": 20, "active": true},
+		{"id": "4", "price": -3, "active": false},
+		{"id": "5", "price": "n/a"},
+		{"id": "6"},
+	}
+	for _, d := range docs {
+		doc, _ := MarshalDocument(d)
+		_ = coll.Put(*doc)
+	}
+	_ = coll.CreateIndex("price")
+	_ = coll.CreateIndex("active")
+	return coll
+}
+
+func queryIDs(t *testing.T, coll *Collection, field string, params QueryParams) []string {
+	docs, err := coll.Query(field, params)
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, d := range docs {
+		ids = append(ids, d.Fields["id"].Value.(string))
+	}
+	return ids
+}
+
+func TestQuery_NumberIndex(t *testing.T) {
+	coll := setupTypedCollection()
+	minPrice := 9.5
+
+	tests := []struct {
+		name   string
+		params QueryParams
+		want   []string
+	}{
+		{name: "full range orders numbers before strings", params: QueryParams{}, want: []string{"4", "1", "3", "2", "5"}},
+		{name: "numeric not lexicographic order", params: QueryParams{MinValue: 10, MaxValue: 100}, want: []string{"3", "2"}},
+		{name: "min only stays within numbers", params: QueryParams{MinValue: &minPrice}, want: []string{"1", "3", "2"}},
+		{name: "max only stays within numbers", params: QueryParams{MaxValue: int64(20), Desc: true}, want: []string{"3", "1", "4"}},
+		{name: "string bound", params: QueryParams{MinValue: "a"}, want: []string{"5"}},
+		{name: "empty", params: QueryParams{MinValue: 1000}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, queryIDs(t, coll, "price", tt.params))
+		})
+	}
+}
+
+func TestQuery_BoolIndex(t *testing.T) {
+	coll := setupTypedCollection()
+	assert.Equal(t, []string{"2", "4", "1", "3"}, queryIDs(t, coll, "active", QueryParams{}))
+	assert.Equal(t, []string{"1", "3"}, queryIDs(t, coll, "active", QueryParams{MinValue: true}))
+	assert.Equal(t, []string{"2", "4"}, queryIDs(t, coll, "active", QueryParams{MaxValue: false}))
+}
+
+func TestQuery_TypedIndexMaintenance(t *testing.T) {
+	coll := setupTypedCollection()
+	doc, _ := MarshalDocument(map[string]any{"id": "3", "price": 5})
+	assert.NoError(t, coll.Put(*doc))
+	assert.NoError(t, coll.Delete("4"))
+	assert.Equal(t, []string{"3", "1", "2"}, queryIDs(t, coll, "price", QueryParams{MinValue: 0}))
+	assert.Equal(t, []string{"1"}, queryIDs(t, coll, "active", QueryParams{MinValue: true}))
+}
@@ -23,8 +23,14 @@ type DocumentField struct {
 	Value interface{}
 }
 
+// Document is a set of named fields. Revision is maintained by the
+// collection holding the document: every put gives the document a revision
+// higher than any the collection handed out before, so a revision is never
+// reused, not even by a document put again after a delete. The revision of
+// a Document passed to Put is ignored.
 type Document struct {
-	Fields map[string]DocumentField
+	Fields   map[string]DocumentField
+	Revision uint64 `json:"Revision,omitempty"`
 }
 
 func MarshalDocument(input any) (*Document, error) {
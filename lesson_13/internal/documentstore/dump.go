@@ -0,0 +1,260 @@
+package documentstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DumpTo writes the store to w in the Store.Dump format. Collections and
+// documents are encoded one at a time in key order, so apart from the sorted
+// keys no copy of the data is built in memory. The store is read-locked for
+// the duration of the call so the dump is consistent across collections.
+func (s *Store) DumpTo(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	unlock := s.rlockCollections()
+	defer unlock()
+
+	bw := bufio.NewWriter(w)
+	if err := s.dumpTo(bw); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDumpStore, err)
+	}
+	return nil
+}
+
+// dumpTo streams the store to w. The caller must hold the store lock and the
+// read locks of all collections.
+func (s *Store) dumpTo(w io.Writer) error {
+	enc := dumpEncoder{w: w}
+
+	names := make([]string, 0, len(s.collections))
+	for name := range s.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	enc.raw(`{"collections":{`)
+	for i, name := range names {
+		if i > 0 {
+			enc.raw(",")
+		}
+		enc.value(name)
+		enc.raw(":")
+		s.collections[name].dumpTo(&enc)
+	}
+	enc.raw("}}")
+
+	if enc.err != nil {
+		return fmt.Errorf("%w: %w", ErrDumpStore, enc.err)
+	}
+	return nil
+}
+
+// dumpTo streams a single collection. The caller must hold the read lock.
+func (s *Collection) dumpTo(enc *dumpEncoder) {
+	keys := make([]string, 0, len(s.documents))
+	var highest uint64
+	for pk, doc := range s.documents {
+		keys = append(keys, pk)
+		highest = max(highest, doc.Revision)
+	}
+	sort.Strings(keys)
+
+	var indexes []IndexConfig
+	for _, idx := range s.indexes {
+		indexes = append(indexes, idx.cfg)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].name() < indexes[j].name() })
+
+	var textIndexes []TextIndexConfig
+	for _, idx := range s.textIndexes {
+		textIndexes = append(textIndexes, idx.cfg)
+	}
+	sort.Slice(textIndexes, func(i, j int) bool { return textIndexes[i].name() < textIndexes[j].name() })
+
+	enc.raw(`{"config":`)
+	enc.value(s.cfg)
+	enc.raw(`,"documents":{`)
+	for i, pk := range keys {
+		if enc.err != nil {
+			return
+		}
+		if i > 0 {
+			enc.raw(",")
+		}
+		enc.value(pk)
+		enc.raw(":")
+		enc.value(s.documents[pk])
+	}
+	enc.raw(`},"indexes":`)
+	enc.value(indexes)
+	// Text indexes are only written when there are any, so dumps of stores
+	// without them stay readable by older versions.
+	if len(textIndexes) > 0 {
+		enc.raw(`,"text_indexes":`)
+		enc.value(textIndexes)
+	}
+	// Restoring takes the revision from the documents; it is only written
+	// when deleted documents had higher ones.
+	if s.revision > highest {
+		enc.raw(`,"revision":`)
+		enc.value(s.revision)
+	}
+	enc.raw("}")
+}
+
+// dumpEncoder writes JSON fragments and remembers the first error, so the
+// streaming code does not have to check every write.
+type dumpEncoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *dumpEncoder) raw(s string) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = io.WriteString(e.w, s)
+}
+
+func (e *dumpEncoder) value(v any) {
+	if e.err != nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		e.err = err
+		return
+	}
+	_, e.err = e.w.Write(data)
+}
+
+// NewStoreFromReader restores a store from a dump in the Store.Dump format,
+// decoding one document at a time instead of unmarshalling the whole dump.
+func NewStoreFromReader(r io.Reader) (*Store, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	store := NewStore()
+
+	err := decodeObject(dec, func(key string) error {
+		if key != "collections" {
+			return skipValue(dec)
+		}
+		return decodeObject(dec, func(name string) error {
+			collection, err := decodeCollection(dec, store, name)
+			if err != nil {
+				return fmt.Errorf("collection %q: %w", name, err)
+			}
+			store.collections[name] = collection
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDumpStore, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: unexpected data after the dump", ErrDumpStore)
+	}
+	return store, nil
+}
+
+func decodeCollection(dec *json.Decoder, store *Store, name string) (*Collection, error) {
+	collection := store.newCollection(name, CollectionConfig{})
+	var indexes []IndexConfig
+	var textIndexes []TextIndexConfig
+
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "config":
+			return dec.Decode(&collection.cfg)
+		case "documents":
+			return decodeObject(dec, func(pk string) error {
+				var doc Document
+				if err := dec.Decode(&doc); err != nil {
+					return err
+				}
+				if doc.Revision == 0 {
+					// Dumped before documents had revisions.
+					doc.Revision = 1
+				}
+				collection.documents[pk] = doc
+				collection.revision = max(collection.revision, doc.Revision)
+				return nil
+			})
+		case "revision":
+			var revision uint64
+			if err := dec.Decode(&revision); err != nil {
+				return err
+			}
+			collection.revision = max(collection.revision, revision)
+			return nil
+		case "indexes":
+			return dec.Decode(&indexes)
+		case "text_indexes":
+			return dec.Decode(&textIndexes)
+		default:
+			return skipValue(dec)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Indexes are built once all documents are loaded, whatever the order
+	// of the keys in the dump.
+	for _, cfg := range indexes {
+		if err := cfg.validate(); err != nil {
+			return nil, err
+		}
+		if err := collection.applyCreateIndex(cfg); err != nil {
+			return nil, err
+		}
+	}
+	for _, cfg := range textIndexes {
+		if err := cfg.validate(); err != nil {
+			return nil, err
+		}
+		collection.applyCreateTextIndex(cfg)
+	}
+	return collection, nil
+}
+
+// decodeObject reads a JSON object, or null, calling fn for every key with
+// the decoder positioned at the corresponding value.
+func decodeObject(dec *json.Decoder, fn func(key string) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected object, got %v", tok)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("expected object key, got %v", tok)
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+func skipValue(dec *json.Decoder) error {
+	var raw json.RawMessage
+	return dec.Decode(&raw)
+}
@@ -0,0 +1,148 @@
+package documentstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleStore(t *testing.T) *Store {
+	s := NewStore()
+	users, _ := s.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	fillUsers(t, users, 0, 25)
+	assert.NoError(t, users.CreateIndex("name"))
+	assert.NoError(t, users.CreateIndex("email"))
+	orders, _ := s.CreateCollection("orders", &CollectionConfig{PrimaryKey: "ref"})
+	assert.NoError(t, orders.Put(Document{Fields: map[string]DocumentField{
+		"ref":   {Type: DocumentFieldTypeString, Value: "<a&b>"},
+		"total": {Type: DocumentFieldTypeNumber, Value: 12.5},
+		"paid":  {Type: DocumentFieldTypeBool, Value: true},
+		"items": {Type: DocumentFieldTypeArray, Value: []any{"x", 2.0}},
+	}}))
+	_, _ = s.CreateCollection("empty", &CollectionConfig{PrimaryKey: "id"})
+	return s
+}
+
+func TestStore_DumpTo(t *testing.T) {
+	s := sampleStore(t)
+
+	var buf bytes.Buffer
+	assert.NoError(t, s.DumpTo(&buf))
+	assert.True(t, json.Valid(buf.Bytes()))
+
+	// The streamed dump is byte for byte what json.Marshal produces for the
+	// equivalent in-memory structure.
+	want, err := json.Marshal(map[string]any{
+		"collections": map[string]any{
+			"users": map[string]any{
+				"config":    s.collections["users"].cfg,
+				"documents": s.collections["users"].documents,
+				"indexes":   []string{"email", "name"},
+			},
+			"orders": map[string]any{
+				"config":    s.collections["orders"].cfg,
+				"documents": s.collections["orders"].documents,
+				"indexes":   nil,
+			},
+			"empty": map[string]any{
+				"config":    s.collections["empty"].cfg,
+				"documents": s.collections["empty"].documents,
+				"indexes":   nil,
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), buf.String())
+
+	dump, err := s.Dump()
+	assert.NoError(t, err)
+	assert.Equal(t, buf.String(), string(dump))
+}
+
+func TestStore_DumpTo_WriteError(t *testing.T) {
+	s := sampleStore(t)
+	err := s.DumpTo(errWriter{})
+	assert.ErrorIs(t, err, ErrDumpStore)
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestNewStoreFromReader(t *testing.T) {
+	s := sampleStore(t)
+	var buf bytes.Buffer
+	assert.NoError(t, s.DumpTo(&buf))
+	want := buf.String()
+
+	restored, err := NewStoreFromReader(iotest.OneByteReader(strings.NewReader(want)))
+	assert.NoError(t, err)
+
+	var got bytes.Buffer
+	assert.NoError(t, restored.DumpTo(&got))
+	assert.Equal(t, want, got.String())
+
+	users, err := restored.GetCollection("users")
+	assert.NoError(t, err)
+	docs, err := users.Query("name", QueryParams{})
+	assert.NoError(t, err)
+	assert.Len(t, docs, 25)
+}
+
+func TestNewStoreFromReader_Compatibility(t *testing.T) {
+	tests := []struct {
+		name    string
+		dump    string
+		wantErr bool
+		wantLen int
+	}{
+		{
+			name:    "keys in any order, indexes before documents",
+			dump:    `{"collections":{"users":{"indexes":["name"],"extra":[1,{"a":2}],"documents":{"1":{"Fields":{"id":{"Type":"string","Value":"1"},"name":{"Type":"string","Value":"Alice"}}}},"config":{"PrimaryKey":"id"}}},"version":1}`,
+			wantLen: 1,
+		},
+		{
+			name:    "null members",
+			dump:    `{"collections":{"users":{"config":{"PrimaryKey":"id"},"documents":null,"indexes":null}}}`,
+			wantLen: 0,
+		},
+		{
+			name:    "truncated",
+			dump:    `{"collections":{"users":{"config":{"PrimaryKey":"id"},"documents":{"1":{"Fields"`,
+			wantErr: true,
+		},
+		{
+			name:    "not an object",
+			dump:    `[]`,
+			wantErr: true,
+		},
+		{
+			name:    "trailing data",
+			dump:    `{"collections":{}} {}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewStoreFromReader(strings.NewReader(tt.dump))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrDumpStore)
+				return
+			}
+			assert.NoError(t, err)
+			users, err := s.GetCollection("users")
+			assert.NoError(t, err)
+			assert.Len(t, users.List(), tt.wantLen)
+			docs, err := users.Query("name", QueryParams{})
+			if tt.wantLen > 0 {
+				assert.NoError(t, err)
+				assert.Len(t, docs, tt.wantLen)
+			}
+		})
+	}
+}
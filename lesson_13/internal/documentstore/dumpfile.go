@@ -0,0 +1,183 @@
+package documentstore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Dump files start with a fixed-size header line holding the CRC-32C and the
+// length of the dump that follows:
+//
+//	DOCSTORE-DUMP 1 <crc32c, 8 hex digits> <length, 16 hex digits>\n
+//
+// Files without the header are plain dumps written by older versions and are
+// read without verification.
+const (
+	dumpFileMagic  = "DOCSTORE-DUMP 1"
+	prevFileSuffix = ".prev"
+)
+
+var dumpHeaderSize = len(dumpFileHeader(0, 0))
+
+var ErrDumpCorrupt = errors.New("dump file is corrupt")
+
+func dumpFileHeader(crc uint32, size int64) []byte {
+	return []byte(fmt.Sprintf("%s %08x %016x\n", dumpFileMagic, crc, size))
+}
+
+// writeDumpFile atomically replaces filename with a checksummed dump file
+// whose body is produced by write. The data goes to a temporary file in the
+// same directory which is synced and renamed over filename, so a crash leaves
+// either the old or the new file in place. With keepPrevious the replaced
+// file is kept as filename.prev: it is linked there before the rename, so
+// filename never goes missing.
+func writeDumpFile(filename string, keepPrevious bool, write func(w io.Writer) error) (err error) {
+	dir := filepath.Dir(filename)
+	f, err := os.CreateTemp(dir, filepath.Base(filename)+".*"+tempFileSuffix)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDumpStoreFile, err)
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	if _, err := f.Write(dumpFileHeader(0, 0)); err != nil {
+		return fmt.Errorf("%w: %w", ErrDumpStoreFile, err)
+	}
+	sum := crc32.New(crcTable)
+	body := &countingWriter{w: io.MultiWriter(f, sum)}
+	bw := bufio.NewWriter(body)
+	if err := write(bw); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDumpStoreFile, err)
+	}
+	if _, err := f.WriteAt(dumpFileHeader(sum.Sum32(), body.n), 0); err != nil {
+		return fmt.Errorf("%w: %w", ErrDumpStoreFile, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDumpStoreFile, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDumpStoreFile, err)
+	}
+
+	if keepPrevious {
+		if err := linkPrevious(filename); err != nil {
+			return fmt.Errorf("%w: %w", ErrDumpStoreFile, err)
+		}
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return fmt.Errorf("%w: %w", ErrDumpStoreFile, err)
+	}
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("%w: %w", ErrDumpStoreFile, err)
+	}
+	return nil
+}
+
+// linkPrevious makes filename.prev a hard link to filename, replacing any
+// older one. A missing filename leaves nothing to keep.
+func linkPrevious(filename string) error {
+	prev := filename + prevFileSuffix
+	if err := os.Remove(prev); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Link(filename, prev); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// readDumpFile streams the body of a dump file to read and verifies its
+// checksum. Any damage, including a body read cannot parse, is reported as
+// ErrDumpCorrupt.
+func readDumpFile(filename string, read func(r io.Reader) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReadFile, err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(dumpFileMagic))
+	if !bytes.Equal(magic, []byte(dumpFileMagic)) {
+		if err := read(br); err != nil {
+			return fmt.Errorf("%w: %w", ErrDumpCorrupt, err)
+		}
+		return nil
+	}
+
+	header := make([]byte, dumpHeaderSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return fmt.Errorf("%w: truncated header", ErrDumpCorrupt)
+	}
+	fields := strings.Fields(string(header[len(dumpFileMagic):]))
+	if len(fields) != 2 {
+		return fmt.Errorf("%w: invalid header", ErrDumpCorrupt)
+	}
+	want, err := strconv.ParseUint(fields[0], 16, 32)
+	if err != nil {
+		return fmt.Errorf("%w: invalid header checksum: %w", ErrDumpCorrupt, err)
+	}
+	size, err := strconv.ParseInt(fields[1], 16, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid header length: %w", ErrDumpCorrupt, err)
+	}
+
+	sum := crc32.New(crcTable)
+	body := &countingReader{r: io.TeeReader(io.LimitReader(br, size), sum)}
+	readErr := read(body)
+	// Checksum the whole body even if read stopped early.
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return fmt.Errorf("%w: %w", ErrReadFile, err)
+	}
+	if body.n != size {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrDumpCorrupt, size, body.n)
+	}
+	if sum.Sum32() != uint32(want) {
+		return fmt.Errorf("%w: checksum mismatch", ErrDumpCorrupt)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return fmt.Errorf("%w: unexpected data after the dump", ErrDumpCorrupt)
+	}
+	if readErr != nil {
+		return fmt.Errorf("%w: %w", ErrDumpCorrupt, readErr)
+	}
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
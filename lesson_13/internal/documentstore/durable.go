@@ -0,0 +1,180 @@
+package documentstore
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StoreOptions configures a persistent store opened with OpenStore.
+type StoreOptions struct {
+	Sync         SyncPolicy
+	SyncInterval time.Duration // used with SyncInterval, defaults to 100ms
+
+	// CheckpointEvery makes the store write a snapshot and compact the
+	// journal in the background after that many records. Zero disables
+	// automatic checkpoints; Store.Checkpoint can still be called.
+	CheckpointEvery int
+}
+
+// OpenStore opens the persistent store kept in dir, creating the directory
+// if needed. Every change made through the returned store is appended to a
+// journal before it is applied. On open the newest valid snapshot is loaded
+// and only the journal records written after it are replayed to rebuild the
+// state after a restart or crash. A nil opts means SyncAlways.
+func OpenStore(dir string, opts *StoreOptions) (*Store, error) {
+	if opts == nil {
+		opts = &StoreOptions{}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrJournalRead, err)
+	}
+
+	removeTempFiles(dir)
+
+	store, base, err := loadSnapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := journalSegments(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrJournalRead, err)
+	}
+
+	if len(segments) > 0 && segments[0].first > base+1 {
+		return nil, fmt.Errorf("%w: journal starts at lsn %d, snapshot covers up to %d", ErrJournalCorrupt, segments[0].first, base)
+	}
+
+	lsn := base
+	var tail string
+	var tailSize int64
+	for i, seg := range segments {
+		size, err := readJournal(seg.path, func(rec journalRecord) error {
+			if rec.LSN <= base {
+				// Already covered by the snapshot.
+				return nil
+			}
+			if rec.LSN != lsn+1 {
+				return fmt.Errorf("%w: expected lsn %d, found %d", ErrJournalCorrupt, lsn+1, rec.LSN)
+			}
+			if err := store.replay(rec); err != nil {
+				return err
+			}
+			lsn = rec.LSN
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(seg.path), err)
+		}
+		if i < len(segments)-1 {
+			if info, err := os.Stat(seg.path); err == nil && info.Size() != size {
+				return nil, fmt.Errorf("%s: %w: torn record before the last segment", filepath.Base(seg.path), ErrJournalCorrupt)
+			}
+		}
+		tail, tailSize = seg.path, size
+	}
+	if tail == "" {
+		tail = filepath.Join(dir, journalFileName(lsn+1))
+	}
+
+	j, err := openJournal(tail, tailSize, lsn, *opts)
+	if err != nil {
+		return nil, err
+	}
+	store.journal = j
+	if opts.CheckpointEvery > 0 {
+		store.startCheckpointer(opts.CheckpointEvery)
+	}
+	l.Info("store opened", slog.String("dir", dir), slog.Uint64("snapshot", base), slog.Uint64("lsn", lsn))
+	return store, nil
+}
+
+// Close flushes and closes the journal of a persistent store. Writes made
+// after Close fail with ErrJournalClosed. Close is a no-op for in-memory
+// stores.
+func (s *Store) Close() error {
+	if s.journal == nil {
+		return nil
+	}
+	s.stopCheckpointer()
+	return s.journal.close()
+}
+
+// replay applies a journal record to a store that is not journaling yet.
+func (s *Store) replay(rec journalRecord) error {
+	switch rec.Op {
+	case opCreateCollection:
+		if rec.Config == nil {
+			return fmt.Errorf("%w: lsn %d: collection %q has no config", ErrJournalCorrupt, rec.LSN, rec.Collection)
+		}
+		if _, err := s.CreateCollection(rec.Collection, rec.Config); err != nil {
+			return fmt.Errorf("%w: lsn %d: %w", ErrJournalCorrupt, rec.LSN, err)
+		}
+		return nil
+	case opDeleteCollection:
+		if err := s.DeleteCollection(rec.Collection); err != nil {
+			return fmt.Errorf("%w: lsn %d: %w", ErrJournalCorrupt, rec.LSN, err)
+		}
+		return nil
+	case opTransaction:
+		for _, op := range rec.Ops {
+			if op.Op != opPut && op.Op != opDelete {
+				return fmt.Errorf("%w: lsn %d: unexpected %q in a transaction", ErrJournalCorrupt, rec.LSN, op.Op)
+			}
+			op.LSN = rec.LSN
+			if err := s.replay(op); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	collection, ok := s.collections[rec.Collection]
+	if !ok {
+		return fmt.Errorf("%w: lsn %d: %w: %s", ErrJournalCorrupt, rec.LSN, ErrCollectionNotFound, rec.Collection)
+	}
+
+	collection.mu.Lock()
+	defer collection.mu.Unlock()
+
+	switch rec.Op {
+	case opPut:
+		if rec.Document == nil {
+			return fmt.Errorf("%w: lsn %d: put without a document", ErrJournalCorrupt, rec.LSN)
+		}
+		pk, err := collection.primaryKey(*rec.Document)
+		if err != nil {
+			return fmt.Errorf("%w: lsn %d: %w", ErrJournalCorrupt, rec.LSN, err)
+		}
+		if rec.Document.Revision == 0 {
+			// Written before documents had revisions.
+			rec.Document.Revision = collection.nextRevision()
+		}
+		collection.applyPut(pk, *rec.Document)
+	case opDelete:
+		collection.applyDelete(rec.Key)
+	case opCreateIndex:
+		cfg := IndexConfig{Fields: []IndexField{{Field: rec.Index}}}
+		if rec.IndexConfig != nil {
+			cfg = *rec.IndexConfig
+		}
+		if err := collection.applyCreateIndex(cfg); err != nil {
+			return fmt.Errorf("%w: lsn %d: %w", ErrJournalCorrupt, rec.LSN, err)
+		}
+	case opCreateTextIndex:
+		if rec.TextIndex == nil {
+			return fmt.Errorf("%w: lsn %d: text index without a config", ErrJournalCorrupt, rec.LSN)
+		}
+		if err := rec.TextIndex.validate(); err != nil {
+			return fmt.Errorf("%w: lsn %d: %w", ErrJournalCorrupt, rec.LSN, err)
+		}
+		collection.applyCreateTextIndex(*rec.TextIndex)
+	case opDeleteIndex:
+		collection.applyDeleteIndex(rec.Index)
+	default:
+		return fmt.Errorf("%w: lsn %d: unknown operation %q", ErrJournalCorrupt, rec.LSN, rec.Op)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package documentstore
+
+import (
+	"time"
+)
+
+// Explain describes how a Find or Query ran. PlanKeysExamined counts the
+// index entries Find reads to choose the index, on top of KeysExamined: it
+// counts the entries in the ranges of every index that applies to pick the
+// one with the fewest.
+type Explain struct {
+	Index            string        `json:"index,omitempty"`    // index read, empty for a full scan
+	Bounds           []IndexBounds `json:"bounds,omitempty"`   // ranges of the index read
+	KeysExamined     int           `json:"keys_examined"`      // index entries read
+	PlanKeysExamined int           `json:"plan_keys_examined"` // index entries read to choose the index
+	DocsExamined     int           `json:"docs_examined"`      // documents read
+	Returned         int           `json:"returned"`           // documents returned
+	Elapsed          time.Duration `json:"elapsed"`            // in nanoseconds in JSON
+}
+
+// IndexBounds is one range of an index read by a query, see QueryParams.
+type IndexBounds struct {
+	Desc         bool   `json:"desc,omitempty"`
+	Prefix       []any  `json:"prefix,omitempty"`
+	Min          any    `json:"min,omitempty"`
+	Max          any    `json:"max,omitempty"`
+	MinExclusive bool   `json:"min_exclusive,omitempty"`
+	MaxExclusive bool   `json:"max_exclusive,omitempty"`
+	StartsWith   string `json:"starts_with,omitempty"`
+}
+
+func boundsOf(params QueryParams) IndexBounds {
+	return IndexBounds{
+		Desc:         params.Desc,
+		Prefix:       params.Prefix,
+		Min:          params.MinValue,
+		Max:          params.MaxValue,
+		MinExclusive: params.MinExclusive,
+		MaxExclusive: params.MaxExclusive,
+		StartsWith:   params.StartsWith,
+	}
+}
+
+// examineKey and examineDoc count the work of a query being explained. They
+// do nothing on a nil Explain, so the plain query paths pass nil.
+func (e *Explain) examineKey() {
+	if e != nil {
+		e.KeysExamined++
+	}
+}
+
+func (e *Explain) examinePlanKey() {
+	if e != nil {
+		e.PlanKeysExamined++
+	}
+}
+
+func (e *Explain) examineDoc() {
+	if e != nil {
+		e.DocsExamined++
+	}
+}
+
+// ExplainFind runs Find with filter and reports how it ran instead of the
+// documents found.
+func (s *Collection) ExplainFind(filter Filter) (Explain, error) {
+	if err := filter.validate(); err != nil {
+		return Explain{}, err
+	}
+
+	start := time.Now()
+	sn := s.Snapshot()
+	var e Explain
+	sn.find(filter, &e, func(string, Document) bool {
+		e.Returned++
+		return true
+	})
+	e.Elapsed = time.Since(start)
+	return e, nil
+}
+
+// ExplainQuery runs QueryPage with the given arguments and reports how it
+// ran instead of the page.
+func (s *Collection) ExplainQuery(indexName string, params QueryParams) (Explain, error) {
+	if err := validatePage(params); err != nil {
+		return Explain{}, err
+	}
+
+	start := time.Now()
+	sn := s.Snapshot()
+	var e Explain
+	page, err := sn.queryPage(indexName, params, &e)
+	if err != nil {
+		return Explain{}, err
+	}
+	e.Returned = len(page.Documents)
+	e.Elapsed = time.Since(start)
+	return e, nil
+}
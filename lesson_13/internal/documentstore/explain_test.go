@@ -0,0 +1,71 @@
+package documentstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainFind(t *testing.T) {
+	coll := setupPeopleCollection(t)
+
+	e, err := coll.ExplainFind(Eq("city", "Kyiv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "", e.Index)
+	assert.Nil(t, e.Bounds)
+	assert.Equal(t, 0, e.KeysExamined)
+	assert.Equal(t, 0, e.PlanKeysExamined)
+	assert.Equal(t, 5, e.DocsExamined)
+	assert.Equal(t, 3, e.Returned)
+
+	assert.NoError(t, coll.CreateIndex("city"))
+	e, err = coll.ExplainFind(And(Eq("city", "Kyiv"), Gt("age", 30)))
+	assert.NoError(t, err)
+	assert.Equal(t, "city", e.Index)
+	assert.Equal(t, []IndexBounds{{Prefix: []any{"Kyiv"}}}, e.Bounds)
+	assert.Equal(t, 3, e.KeysExamined)
+	assert.Equal(t, 3, e.PlanKeysExamined)
+	assert.Equal(t, 3, e.DocsExamined)
+	assert.Equal(t, 1, e.Returned)
+	assert.GreaterOrEqual(t, e.Elapsed.Nanoseconds(), int64(0))
+
+	e, err = coll.ExplainFind(In("city", "Lviv", "Odesa"))
+	assert.NoError(t, err)
+	assert.Equal(t, []IndexBounds{{Prefix: []any{"Lviv"}}, {Prefix: []any{"Odesa"}}}, e.Bounds)
+	assert.Equal(t, 2, e.Returned)
+
+	_, err = coll.ExplainFind(Filter{Op: "bad"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestExplainQuery(t *testing.T) {
+	coll := setupPeopleCollection(t)
+	assert.NoError(t, coll.CreateIndex("city"))
+
+	tests := []struct {
+		name      string
+		params    QueryParams
+		wantKeys  int
+		wantDocs  int
+		wantCount int
+	}{
+		{name: "range", params: QueryParams{MinValue: "Kyiv", MaxValue: "Lviv"}, wantKeys: 4, wantDocs: 4, wantCount: 4},
+		{name: "limit reads one more key", params: QueryParams{MinValue: "Kyiv", MaxValue: "Kyiv", Limit: 2}, wantKeys: 3, wantDocs: 2, wantCount: 2},
+		{name: "skipped keys are not fetched", params: QueryParams{MinValue: "Kyiv", MaxValue: "Kyiv", Skip: 2}, wantKeys: 3, wantDocs: 1, wantCount: 1},
+		{name: "sort reads the whole range", params: QueryParams{MinValue: "Kyiv", MaxValue: "Kyiv", Sort: []SortField{{Field: "age"}}, Limit: 1}, wantKeys: 3, wantDocs: 3, wantCount: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := coll.ExplainQuery("city", tt.params)
+			assert.NoError(t, err)
+			assert.Equal(t, "city", e.Index)
+			assert.Equal(t, []IndexBounds{boundsOf(tt.params)}, e.Bounds)
+			assert.Equal(t, tt.wantKeys, e.KeysExamined)
+			assert.Equal(t, tt.wantDocs, e.DocsExamined)
+			assert.Equal(t, tt.wantCount, e.Returned)
+		})
+	}
+
+	_, err := coll.ExplainQuery("missing", QueryParams{})
+	assert.ErrorIs(t, err, ErrIndexNotFound)
+}
@@ -0,0 +1,199 @@
+package documentstore
+
+import (
+	"fmt"
+	"reflect"
+)
+
+type FilterOp string
+
+const (
+	FilterEq     FilterOp = "eq"
+	FilterNe     FilterOp = "ne"
+	FilterGt     FilterOp = "gt"
+	FilterGte    FilterOp = "gte"
+	FilterLt     FilterOp = "lt"
+	FilterLte    FilterOp = "lte"
+	FilterIn     FilterOp = "in"
+	FilterNin    FilterOp = "nin"
+	FilterExists FilterOp = "exists"
+	FilterAnd    FilterOp = "and"
+	FilterOr     FilterOp = "or"
+	FilterNot    FilterOp = "not"
+)
+
+// Filter is a predicate over documents. Comparison filters test the field
+// at a dotted path against Value, or Values for in and nin; and, or and not
+// combine Filters. Filters are plain data so they can be sent as JSON.
+//
+// Comparisons follow the index ordering and, like index bounds, only match
+// values of the type of their operand: Gt(field, 10) matches numbers above
+// 10 and no strings. An array field matches if any of its elements or the
+// array as a whole does; ne and nin match when eq and in would not. A
+// missing field equals nil.
+type Filter struct {
+	Op      FilterOp `json:"op"`
+	Field   string   `json:"field,omitempty"`
+	Value   any      `json:"value,omitempty"`
+	Values  []any    `json:"values,omitempty"`
+	Filters []Filter `json:"filters,omitempty"`
+}
+
+func Eq(field string, value any) Filter  { return Filter{Op: FilterEq, Field: field, Value: value} }
+func Ne(field string, value any) Filter  { return Filter{Op: FilterNe, Field: field, Value: value} }
+func Gt(field string, value any) Filter  { return Filter{Op: FilterGt, Field: field, Value: value} }
+func Gte(field string, value any) Filter { return Filter{Op: FilterGte, Field: field, Value: value} }
+func Lt(field string, value any) Filter  { return Filter{Op: FilterLt, Field: field, Value: value} }
+func Lte(field string, value any) Filter { return Filter{Op: FilterLte, Field: field, Value: value} }
+
+func In(field string, values ...any) Filter {
+	return Filter{Op: FilterIn, Field: field, Values: values}
+}
+
+func Nin(field string, values ...any) Filter {
+	return Filter{Op: FilterNin, Field: field, Values: values}
+}
+
+// Exists matches documents that have the field if exists is true, and those
+// that do not otherwise.
+func Exists(field string, exists bool) Filter {
+	return Filter{Op: FilterExists, Field: field, Value: exists}
+}
+
+func And(filters ...Filter) Filter { return Filter{Op: FilterAnd, Filters: filters} }
+func Or(filters ...Filter) Filter  { return Filter{Op: FilterOr, Filters: filters} }
+func Not(filter Filter) Filter     { return Filter{Op: FilterNot, Filters: []Filter{filter}} }
+
+func (f Filter) validate() error {
+	switch f.Op {
+	case FilterAnd, FilterOr:
+		if len(f.Filters) == 0 {
+			return fmt.Errorf("%w: %s without filters", ErrInvalidQuery, f.Op)
+		}
+	case FilterNot:
+		if len(f.Filters) != 1 {
+			return fmt.Errorf("%w: not takes exactly one filter", ErrInvalidQuery)
+		}
+	case FilterEq, FilterNe, FilterGt, FilterGte, FilterLt, FilterLte, FilterIn, FilterNin, FilterExists:
+		if f.Field == "" || !validPath(f.Field) {
+			return fmt.Errorf("%w: invalid field path %q", ErrInvalidQuery, f.Field)
+		}
+		if _, ok := f.Value.(bool); f.Op == FilterExists && !ok {
+			return fmt.Errorf("%w: exists takes a bool", ErrInvalidQuery)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown filter operator %q", ErrInvalidQuery, f.Op)
+	}
+	for _, sub := range f.Filters {
+		if err := sub.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match reports whether doc satisfies the filter, which must be valid.
+func (f Filter) match(doc Document) bool {
+	switch f.Op {
+	case FilterAnd:
+		for _, sub := range f.Filters {
+			if !sub.match(doc) {
+				return false
+			}
+		}
+		return true
+	case FilterOr:
+		for _, sub := range f.Filters {
+			if sub.match(doc) {
+				return true
+			}
+		}
+		return false
+	case FilterNot:
+		return !f.Filters[0].match(doc)
+	}
+
+	values, found := filterValues(doc, f.Field)
+	switch f.Op {
+	case FilterExists:
+		return found == f.Value.(bool)
+	case FilterEq:
+		return matchAny(values, found, f.Value, equalValues)
+	case FilterNe:
+		return !matchAny(values, found, f.Value, equalValues)
+	case FilterIn:
+		return matchIn(values, found, f.Values)
+	case FilterNin:
+		return !matchIn(values, found, f.Values)
+	}
+
+	want := normalizeValue(f.Value)
+	return matchAny(values, found, want, func(v, want any) bool {
+		if typeRank(v) != typeRank(want) {
+			return false
+		}
+		c := compareValues(v, want)
+		switch f.Op {
+		case FilterGt:
+			return c > 0
+		case FilterGte:
+			return c >= 0
+		case FilterLt:
+			return c < 0
+		}
+		return c <= 0
+	})
+}
+
+// filterValues returns the normalized values a filter on path tests: the
+// field value itself and, for arrays, each element.
+func filterValues(doc Document, path string) ([]any, bool) {
+	field, ok := doc.Lookup(path)
+	if !ok {
+		return nil, false
+	}
+	value := normalizeValue(field.Value)
+	values := []any{value}
+	if field.Type == DocumentFieldTypeArray {
+		rv := reflect.ValueOf(field.Value)
+		if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			for i := 0; i < rv.Len(); i++ {
+				values = append(values, normalizeValue(rv.Index(i).Interface()))
+			}
+		}
+	}
+	return values, true
+}
+
+func matchAny(values []any, found bool, want any, fn func(v, want any) bool) bool {
+	if !found {
+		values = []any{nil}
+	}
+	for _, v := range values {
+		if fn(v, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchIn(values []any, found bool, wants []any) bool {
+	for _, want := range wants {
+		if matchAny(values, found, want, equalValues) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalValues compares scalars in the index ordering, so 1 equals 1.0, and
+// other values structurally.
+func equalValues(a, b any) bool {
+	a, b = normalizeValue(a), normalizeValue(b)
+	switch typeRank(a) {
+	case rankObject, rankArray:
+		return reflect.DeepEqual(a, b)
+	}
+	return typeRank(a) == typeRank(b) && compareValues(a, b) == 0
+}
@@ -0,0 +1,199 @@
+package documentstore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Match(t *testing.T) {
+	doc, _ := MarshalDocument(map[string]any{
+		"id":      "1",
+		"age":     30,
+		"name":    "alice",
+		"active":  true,
+		"tags":    []any{"go", "db", 7},
+		"address": map[string]any{"city": "Lviv"},
+	})
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "eq", filter: Eq("name", "alice"), want: true},
+		{name: "eq number kinds", filter: Eq("age", int64(30)), want: true},
+		{name: "eq other type", filter: Eq("age", "30"), want: false},
+		{name: "eq nested", filter: Eq("address.city", "Lviv"), want: true},
+		{name: "eq array element", filter: Eq("tags", "db"), want: true},
+		{name: "eq whole array", filter: Eq("tags", []any{"go", "db", 7}), want: true},
+		{name: "eq nil missing", filter: Eq("email", nil), want: true},
+		{name: "eq nil present", filter: Eq("name", nil), want: false},
+		{name: "ne", filter: Ne("name", "bob"), want: true},
+		{name: "ne array element", filter: Ne("tags", "go"), want: false},
+		{name: "ne missing", filter: Ne("email", "x"), want: true},
+		{name: "gt", filter: Gt("age", 29.5), want: true},
+		{name: "gt equal", filter: Gt("age", 30), want: false},
+		{name: "gte", filter: Gte("age", 30), want: true},
+		{name: "lt", filter: Lt("age", 30), want: false},
+		{name: "lte", filter: Lte("age", 30), want: true},
+		{name: "range other type", filter: Lt("age", "z"), want: false},
+		{name: "range array element", filter: Gt("tags", 5), want: true},
+		{name: "range missing", filter: Gt("email", ""), want: false},
+		{name: "in", filter: In("name", "bob", "alice"), want: true},
+		{name: "in none", filter: In("name", "bob"), want: false},
+		{name: "in array", filter: In("tags", 7, "rust"), want: true},
+		{name: "nin", filter: Nin("name", "bob"), want: true},
+		{name: "nin array", filter: Nin("tags", "rust", "db"), want: false},
+		{name: "exists", filter: Exists("address.city", true), want: true},
+		{name: "not exists", filter: Exists("address.zip", false), want: true},
+		{name: "and", filter: And(Eq("name", "alice"), Gte("age", 18)), want: true},
+		{name: "and fails", filter: And(Eq("name", "alice"), Lt("age", 18)), want: false},
+		{name: "or", filter: Or(Eq("name", "bob"), Eq("active", true)), want: true},
+		{name: "not", filter: Not(Eq("active", false)), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tt.filter.validate())
+			assert.Equal(t, tt.want, tt.filter.match(*doc))
+		})
+	}
+}
+
+func TestFilter_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+	}{
+		{name: "unknown op", filter: Filter{Op: "like", Field: "a"}},
+		{name: "no field", filter: Eq("", 1)},
+		{name: "bad path", filter: Eq("a..b", 1)},
+		{name: "exists without bool", filter: Filter{Op: FilterExists, Field: "a"}},
+		{name: "empty and", filter: And()},
+		{name: "not with two filters", filter: Filter{Op: FilterNot, Filters: []Filter{Eq("a", 1), Eq("b", 1)}}},
+		{name: "nested", filter: Or(Eq("a", 1), Not(Filter{Op: "??"}))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.filter.validate(), ErrInvalidQuery)
+		})
+	}
+}
+
+func TestFilter_JSON(t *testing.T) {
+	var f Filter
+	err := json.Unmarshal([]byte(`{"op":"and","filters":[{"op":"gte","field":"age","value":18},{"op":"in","field":"tags","values":["go"]}]}`), &f)
+	assert.NoError(t, err)
+	assert.Equal(t, And(Gte("age", 18.0), In("tags", "go")), f)
+}
+
+func setupPeopleCollection(t *testing.T) *Collection {
+	coll := &Collection{
+		cfg:       CollectionConfig{PrimaryKey: "id"},
+		documents: map[string]Document{},
+	}
+	for _, p := range []map[string]any{
+		{"id": "1", "name": "alice", "age": 30, "city": "Kyiv", "tags": []any{1, 10}},
+		{"id": "2", "name": "bob", "age": 25, "city": "Lviv", "tags": []any{3}},
+		{"id": "3", "name": "carol", "age": 35, "city": "Kyiv"},
+		{"id": "4", "name": "dave", "age": 40, "city": "Odesa"},
+		{"id": "5", "name": "erin", "city": "Kyiv"},
+	} {
+		doc, _ := MarshalDocument(p)
+		assert.NoError(t, coll.Put(*doc))
+	}
+	return coll
+}
+
+func findIDs(t *testing.T, coll *Collection, f Filter) []string {
+	docs, err := coll.Find(f)
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, d := range docs {
+		ids = append(ids, d.Fields["id"].Value.(string))
+	}
+	return ids
+}
+
+func TestFind(t *testing.T) {
+	coll := setupPeopleCollection(t)
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{name: "eq", filter: Eq("city", "Kyiv"), want: []string{"1", "3", "5"}},
+		{name: "range", filter: And(Gte("age", 30), Lt("age", 40)), want: []string{"1", "3"}},
+		{name: "in", filter: In("name", "dave", "bob"), want: []string{"2", "4"}},
+		{name: "and", filter: And(Eq("city", "Kyiv"), Gt("age", 30)), want: []string{"3"}},
+		{name: "or", filter: Or(Eq("city", "Odesa"), Lt("age", 26)), want: []string{"2", "4"}},
+		{name: "not", filter: Not(Exists("age", true)), want: []string{"5"}},
+		{name: "multikey bounds on different elements", filter: And(Gt("tags", 5), Lt("tags", 2)), want: []string{"1"}},
+		{name: "eq nil", filter: Eq("age", nil), want: []string{"5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" full scan", func(t *testing.T) {
+			assert.Equal(t, tt.want, findIDs(t, coll, tt.filter))
+		})
+	}
+
+	assert.NoError(t, coll.CreateIndex("city"))
+	assert.NoError(t, coll.CreateIndex("age"))
+	assert.NoError(t, coll.CreateIndex("name"))
+	assert.NoError(t, coll.CreateIndex("tags"))
+	assert.NoError(t, coll.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "city"}, {Field: "age", Desc: true}}}))
+	for _, tt := range tests {
+		t.Run(tt.name+" indexed", func(t *testing.T) {
+			assert.ElementsMatch(t, tt.want, findIDs(t, coll, tt.filter))
+		})
+	}
+
+	_, err := coll.Find(Filter{Op: "like"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestCollection_Plan(t *testing.T) {
+	coll := setupPeopleCollection(t)
+	assert.NoError(t, coll.CreateIndex("city"))
+	assert.NoError(t, coll.CreateIndex("age"))
+	assert.NoError(t, coll.CreateIndex("tags"))
+	assert.NoError(t, coll.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "city"}, {Field: "age", Desc: true}}}))
+
+	tests := []struct {
+		name      string
+		filter    Filter
+		wantIndex string
+		wantScans []QueryParams
+	}{
+		{name: "no indexed field", filter: Eq("name", "bob")},
+		{name: "or is not planned", filter: Or(Eq("city", "Kyiv"), Eq("age", 25))},
+		{name: "eq nil is not planned", filter: Eq("city", nil)},
+		{name: "most selective index", filter: And(Gte("age", 20), Eq("tags", 10)), wantIndex: "tags",
+			wantScans: []QueryParams{{Prefix: []any{10.0}}}},
+		{name: "more fields on a tie", filter: And(Eq("city", "Kyiv"), Gte("age", 40)), wantIndex: "city,-age",
+			wantScans: []QueryParams{{Prefix: []any{"Kyiv"}, MinValue: 40.0}}},
+		{name: "compound prefix and range", filter: And(Eq("city", "Kyiv"), Gte("age", 30), Lte("age", 31)), wantIndex: "city,-age",
+			wantScans: []QueryParams{{Prefix: []any{"Kyiv"}, MinValue: 30.0, MaxValue: 31.0}}},
+		{name: "in expands to sorted scans", filter: In("age", 40, 25), wantIndex: "age",
+			wantScans: []QueryParams{{Prefix: []any{25.0}}, {Prefix: []any{40.0}}}},
+		{name: "multikey uses one bound", filter: And(Gt("tags", 2), Lt("tags", 5)), wantIndex: "tags",
+			wantScans: []QueryParams{{Prefix: []any{}, MinValue: 2.0, MinExclusive: true}}},
+		{name: "exclusive bounds", filter: And(Gt("age", 25), Lt("age", 40)), wantIndex: "age",
+			wantScans: []QueryParams{{Prefix: []any{}, MinValue: 25.0, MinExclusive: true, MaxValue: 40.0, MaxExclusive: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := coll.Snapshot().plan(tt.filter, nil)
+			if tt.wantIndex == "" {
+				assert.Nil(t, plan.index)
+				return
+			}
+			if assert.NotNil(t, plan.index) {
+				assert.Equal(t, tt.wantIndex, plan.index.cfg.name())
+			}
+			assert.Equal(t, tt.wantScans, plan.scans)
+		})
+	}
+}
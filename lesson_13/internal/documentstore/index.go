@@ -0,0 +1,463 @@
+package documentstore
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/google/btree"
+)
+
+var (
+	ErrInvalidIndex = errors.New("invalid index config")
+	ErrInvalidQuery = errors.New("invalid query")
+	ErrDuplicateKey = errors.New("duplicate key in unique index")
+)
+
+// IndexField is one component of an index key.
+type IndexField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// IndexConfig describes a secondary index over one or more fields. Entries
+// are ordered by the first field, then by the second and so on, each in its
+// own direction. A unique index rejects documents whose key is already held
+// by another document; documents left out of the index are not constrained.
+type IndexConfig struct {
+	Name   string       `json:"name,omitempty"` // defaults to the fields joined by commas, "-" marking descending ones
+	Fields []IndexField `json:"fields"`
+	Unique bool         `json:"unique,omitempty"`
+}
+
+func (c IndexConfig) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	names := make([]string, len(c.Fields))
+	for i, f := range c.Fields {
+		names[i] = f.Field
+		if f.Desc {
+			names[i] = "-" + f.Field
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func (c IndexConfig) validate() error {
+	if len(c.Fields) == 0 {
+		return fmt.Errorf("%w: no fields", ErrInvalidIndex)
+	}
+	seen := make(map[string]bool, len(c.Fields))
+	for _, f := range c.Fields {
+		if f.Field == "" {
+			return fmt.Errorf("%w: empty field name", ErrInvalidIndex)
+		}
+		if !validPath(f.Field) {
+			return fmt.Errorf("%w: invalid field path %q", ErrInvalidIndex, f.Field)
+		}
+		if seen[f.Field] {
+			return fmt.Errorf("%w: field %q is used twice", ErrInvalidIndex, f.Field)
+		}
+		seen[f.Field] = true
+	}
+	return nil
+}
+
+// simple reports whether the config is what CreateIndex(field) produces.
+// Such indexes are stored in dumps as a bare field name.
+func (c IndexConfig) simple() bool {
+	return len(c.Fields) == 1 && !c.Fields[0].Desc && !c.Unique && (c.Name == "" || c.Name == c.Fields[0].Field)
+}
+
+func (c IndexConfig) MarshalJSON() ([]byte, error) {
+	if c.simple() {
+		return json.Marshal(c.Fields[0].Field)
+	}
+	type plain IndexConfig
+	return json.Marshal(plain(c))
+}
+
+func (c *IndexConfig) UnmarshalJSON(data []byte) error {
+	var field string
+	if err := json.Unmarshal(data, &field); err == nil {
+		*c = IndexConfig{Fields: []IndexField{{Field: field}}}
+		return nil
+	}
+	type plain IndexConfig
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+type index struct {
+	cfg  IndexConfig
+	tree *btree.BTreeG[*indexItem]
+
+	// entries holds the keys each document was inserted under, so they can
+	// be removed even if the stored document was modified in place. It is
+	// a B-tree rather than a map so that snapshots can share it.
+	entries *btree.BTreeG[*indexEntry]
+
+	// multikey is set once a document got more than one entry, from then on
+	// scans drop repeated primary keys.
+	multikey bool
+}
+
+type indexItem struct {
+	keys []any  // normalized string, float64, bool or nil value per index field
+	pk   string // primary key
+
+	// last marks a search pivot that sorts after every entry sharing its
+	// keys. Stored entries never set it.
+	last bool
+}
+
+type indexEntry struct {
+	pk   string
+	keys [][]any
+}
+
+func newIndex(cfg IndexConfig) *index {
+	idx := &index{cfg: cfg}
+	idx.tree = btree.NewG(8, idx.less)
+	idx.entries = btree.NewG(8, func(a, b *indexEntry) bool { return a.pk < b.pk })
+	return idx
+}
+
+// clone returns a copy of the index that later writes to either do not
+// affect. The trees are copied lazily, node by node as they are written to.
+// The caller must hold the lock exclusively against other clones and
+// writes.
+func (idx *index) clone() *index {
+	return &index{cfg: idx.cfg, tree: idx.tree.Clone(), entries: idx.entries.Clone(), multikey: idx.multikey}
+}
+
+// entryKeys returns the keys the document stored under pk was inserted
+// under.
+func (idx *index) entryKeys(pk string) [][]any {
+	if e, ok := idx.entries.Get(&indexEntry{pk: pk}); ok {
+		return e.keys
+	}
+	return nil
+}
+
+// less orders entries by their keys, each in the direction of its field,
+// then by primary key. Pivots may carry fewer keys than the index has
+// fields; they sort before the entries they prefix unless marked last.
+func (idx *index) less(a, b *indexItem) bool {
+	n := min(len(a.keys), len(b.keys))
+	for i := 0; i < n; i++ {
+		c := compareKeys(a.keys[i], b.keys[i])
+		if idx.cfg.Fields[i].Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	if a.last != b.last {
+		return b.last
+	}
+	if len(a.keys) != len(b.keys) {
+		return len(a.keys) < len(b.keys)
+	}
+	return a.pk < b.pk
+}
+
+// keys returns the index keys of doc. Fields are looked up by their dotted
+// path. Missing fields and values that cannot be indexed count as null. An
+// array field contributes one key per distinct scalar element, an empty
+// array counting as null, so a document gets an entry for every combination
+// of its elements. Documents where every field is null are left out of the
+// index.
+func (idx *index) keys(doc Document) [][]any {
+	keys := [][]any{{}}
+	found := false
+	for _, f := range idx.cfg.Fields {
+		values := []any{nil}
+		if field, ok := doc.Lookup(f.Field); ok {
+			if field.Type == DocumentFieldTypeArray {
+				if elems := elementKeys(field.Value); len(elems) > 0 {
+					values = elems
+					found = true
+				}
+			} else if key, ok := scalarKey(field); ok {
+				values[0] = key
+				found = true
+			}
+		}
+
+		next := make([][]any, 0, len(keys)*len(values))
+		for _, prefix := range keys {
+			for _, v := range values {
+				next = append(next, append(prefix[:len(prefix):len(prefix)], v))
+			}
+		}
+		keys = next
+	}
+	if !found {
+		return nil
+	}
+	return keys
+}
+
+// elementKeys returns the distinct normalized scalar elements of an array
+// value. Elements that are not strings, numbers or bools are skipped.
+func elementKeys(v any) []any {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	var keys []any
+	for i := 0; i < rv.Len(); i++ {
+		key := normalizeValue(rv.Index(i).Interface())
+		switch key.(type) {
+		case string, float64, bool:
+		default:
+			continue
+		}
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (idx *index) insert(pk string, doc Document) {
+	keys := idx.keys(doc)
+	if len(keys) == 0 {
+		return
+	}
+	if len(keys) > 1 {
+		idx.multikey = true
+	}
+	for _, k := range keys {
+		idx.tree.ReplaceOrInsert(&indexItem{keys: k, pk: pk})
+	}
+	idx.entries.ReplaceOrInsert(&indexEntry{pk: pk, keys: keys})
+}
+
+func (idx *index) remove(pk string) {
+	e, ok := idx.entries.Delete(&indexEntry{pk: pk})
+	if !ok {
+		return
+	}
+	for _, k := range e.keys {
+		idx.tree.Delete(&indexItem{keys: k, pk: pk})
+	}
+}
+
+// conflict returns the primary key of a document other than pk stored under
+// keys, if any.
+func (idx *index) conflict(pk string, keys []any) (string, bool) {
+	var other string
+	idx.tree.AscendGreaterOrEqual(&indexItem{keys: keys}, func(item *indexItem) bool {
+		for i, v := range keys {
+			if compareValues(item.keys[i], v) != 0 {
+				return false
+			}
+		}
+		if item.pk == pk {
+			return true
+		}
+		other = item.pk
+		return false
+	})
+	return other, other != ""
+}
+
+// typeEdge is a pivot key sorting right before (or, with end, right after)
+// every value of one type. Ranges use it to bracket a single bound to the
+// type of its value.
+type typeEdge struct {
+	rank int
+	end  bool
+}
+
+// compareKeys is compareValues extended to typeEdge pivots.
+func compareKeys(a, b any) int {
+	ea, aIsEdge := a.(typeEdge)
+	eb, bIsEdge := b.(typeEdge)
+	if !aIsEdge && !bIsEdge {
+		return compareValues(a, b)
+	}
+	if aIsEdge && bIsEdge {
+		switch {
+		case ea.rank != eb.rank:
+			return cmp.Compare(ea.rank, eb.rank)
+		case ea.end == eb.end:
+			return 0
+		case ea.end:
+			return 1
+		}
+		return -1
+	}
+	if bIsEdge {
+		return -compareKeys(b, a)
+	}
+	if r := typeRank(b); r != ea.rank {
+		return cmp.Compare(ea.rank, r)
+	}
+	if ea.end {
+		return 1
+	}
+	return -1
+}
+
+// keyRange is the part of an index selected by QueryParams, the entries
+// from start up to but excluding stop in tree order. Neither pivot can be
+// equal to a stored entry.
+type keyRange struct {
+	start, stop *indexItem
+}
+
+// bound is one end of a range over the key following the prefix, in the
+// order of values.
+type bound struct {
+	key       any
+	exclusive bool
+}
+
+func (idx *index) keyRange(params QueryParams) (keyRange, error) {
+	n := len(idx.cfg.Fields)
+	k := len(params.Prefix)
+	if k > n {
+		return keyRange{}, fmt.Errorf("%w: prefix of %d values for an index of %d fields", ErrInvalidQuery, k, n)
+	}
+	ranged := params.MinValue != nil || params.MaxValue != nil || params.StartsWith != ""
+	if k == n && ranged {
+		return keyRange{}, fmt.Errorf("%w: no index field left for the range", ErrInvalidQuery)
+	}
+	if params.StartsWith != "" && (params.MinValue != nil || params.MaxValue != nil) {
+		return keyRange{}, fmt.Errorf("%w: starts with cannot be combined with bounds", ErrInvalidQuery)
+	}
+
+	prefix := make([]any, k)
+	for i, v := range params.Prefix {
+		prefix[i] = normalizeValue(v)
+	}
+	if !ranged {
+		return keyRange{
+			start: &indexItem{keys: prefix},
+			stop:  &indexItem{keys: prefix, last: true},
+		}, nil
+	}
+
+	// A single bound only matches keys of its own type, so the open end
+	// stops at the edge of that type.
+	var lower, upper bound
+	switch {
+	case params.StartsWith != "":
+		lower = bound{key: params.StartsWith}
+		upper = bound{key: typeEdge{rank: rankString, end: true}}
+		if end, ok := prefixEnd(params.StartsWith); ok {
+			upper = bound{key: end, exclusive: true}
+		}
+	case params.MinValue != nil && params.MaxValue != nil:
+		lower = bound{key: normalizeValue(params.MinValue), exclusive: params.MinExclusive}
+		upper = bound{key: normalizeValue(params.MaxValue), exclusive: params.MaxExclusive}
+	case params.MinValue != nil:
+		lower = bound{key: normalizeValue(params.MinValue), exclusive: params.MinExclusive}
+		upper = bound{key: typeEdge{rank: typeRank(lower.key), end: true}}
+	default:
+		upper = bound{key: normalizeValue(params.MaxValue), exclusive: params.MaxExclusive}
+		lower = bound{key: typeEdge{rank: typeRank(upper.key)}}
+	}
+	if idx.cfg.Fields[k].Desc {
+		lower, upper = upper, lower
+	}
+
+	// A pivot marked last sorts after the entries holding its key, one
+	// without before them.
+	return keyRange{
+		start: &indexItem{keys: append(prefix[:k:k], lower.key), last: lower.exclusive},
+		stop:  &indexItem{keys: append(prefix[:k:k], upper.key), last: !upper.exclusive},
+	}, nil
+}
+
+// prefixEnd returns the smallest string greater than every string starting
+// with prefix, if there is one.
+func prefixEnd(prefix string) (string, bool) {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1]), true
+		}
+	}
+	return "", false
+}
+
+func (r keyRange) contains(idx *index, item *indexItem) bool {
+	return !idx.less(item, r.start) && idx.less(item, r.stop)
+}
+
+// first reports whether item is the first entry of its document within the
+// range in scan order. Only multikey indexes have documents with several
+// entries.
+func (idx *index) first(r keyRange, item *indexItem, desc bool) bool {
+	if !idx.multikey {
+		return true
+	}
+	for _, keys := range idx.entryKeys(item.pk) {
+		other := &indexItem{keys: keys, pk: item.pk}
+		if !r.contains(idx, other) {
+			continue
+		}
+		if desc && idx.less(item, other) || !desc && idx.less(other, item) {
+			return false
+		}
+	}
+	return true
+}
+
+// scan calls fn for the entries selected by params, in index order or in
+// reverse with params.Desc, until fn returns false. With params.Cursor it
+// resumes after the entry the cursor was taken at. A document matching
+// through several array elements is only reported for the first of them,
+// so it is reported once even across pages.
+func (idx *index) scan(params QueryParams, fn func(item *indexItem) bool) error {
+	r, err := idx.keyRange(params)
+	if err != nil {
+		return err
+	}
+	var resume *indexItem
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return err
+		}
+		if c.Sorted || c.Index != idx.cfg.name() || len(c.Keys) != len(idx.cfg.Fields) {
+			return fmt.Errorf("%w: not a cursor of index %q", ErrInvalidCursor, idx.cfg.name())
+		}
+		resume = &indexItem{keys: c.Keys, pk: c.PK}
+	}
+
+	if params.Desc {
+		from := r.stop
+		if resume != nil && idx.less(resume, from) {
+			from = resume
+		}
+		idx.tree.DescendRange(from, r.start, func(item *indexItem) bool {
+			if resume != nil && !idx.less(item, resume) {
+				return true
+			}
+			return !idx.first(r, item, true) || fn(item)
+		})
+	} else {
+		from := r.start
+		if resume != nil && idx.less(from, resume) {
+			from = resume
+		}
+		idx.tree.AscendRange(from, r.stop, func(item *indexItem) bool {
+			if resume != nil && !idx.less(resume, item) {
+				return true
+			}
+			return !idx.first(r, item, false) || fn(item)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+package documentstore
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupEventsCollection(t *testing.T) *Collection {
+	coll := &Collection{
+		cfg:       CollectionConfig{PrimaryKey: "id"},
+		documents: map[string]Document{},
+	}
+	events := []map[string]any{
+		{"id": "a1", "tenant": "acme", "createdAt": 1},
+		{"id": "a2", "tenant": "acme", "createdAt": 2},
+		{"id": "a3", "tenant": "acme", "createdAt": 3},
+		{"id": "b1", "tenant": "beta", "createdAt": 1},
+		{"id": "b2", "tenant": "beta", "createdAt": 5},
+		{"id": "n1", "createdAt": 4},
+		{"id": "x1", "other": true},
+	}
+	for _, e := range events {
+		doc, _ := MarshalDocument(e)
+		assert.NoError(t, coll.Put(*doc))
+	}
+	assert.NoError(t, coll.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{
+		{Field: "tenant"},
+		{Field: "createdAt", Desc: true},
+	}}))
+	return coll
+}
+
+func TestQuery_CompoundIndex(t *testing.T) {
+	coll := setupEventsCollection(t)
+
+	tests := []struct {
+		name   string
+		params QueryParams
+		want   []string
+	}{
+		{name: "whole index", params: QueryParams{}, want: []string{"n1", "a3", "a2", "a1", "b2", "b1"}},
+		{name: "whole index reversed", params: QueryParams{Desc: true}, want: []string{"b1", "b2", "a1", "a2", "a3", "n1"}},
+		{name: "prefix", params: QueryParams{Prefix: []any{"acme"}}, want: []string{"a3", "a2", "a1"}},
+		{name: "prefix reversed", params: QueryParams{Prefix: []any{"acme"}, Desc: true}, want: []string{"a1", "a2", "a3"}},
+		{name: "prefix and range", params: QueryParams{Prefix: []any{"acme"}, MinValue: 2}, want: []string{"a3", "a2"}},
+		{name: "prefix and max", params: QueryParams{Prefix: []any{"acme"}, MaxValue: 2}, want: []string{"a2", "a1"}},
+		{name: "prefix and both bounds reversed", params: QueryParams{Prefix: []any{"beta"}, MinValue: 1, MaxValue: 4, Desc: true}, want: []string{"b1"}},
+		{name: "full key", params: QueryParams{Prefix: []any{"beta", 5}}, want: []string{"b2"}},
+		{name: "range on the first field", params: QueryParams{MinValue: "b"}, want: []string{"b2", "b1"}},
+		{name: "missing prefix", params: QueryParams{Prefix: []any{"zeta"}}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, queryIDs(t, coll, "tenant,-createdAt", tt.params))
+		})
+	}
+}
+
+func TestQuery_CompoundIndexInvalid(t *testing.T) {
+	coll := setupEventsCollection(t)
+	_, err := coll.Query("tenant,-createdAt", QueryParams{Prefix: []any{"acme", 1, 2}})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = coll.Query("tenant,-createdAt", QueryParams{Prefix: []any{"acme", 1}, MinValue: 1})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestQuery_CompoundIndexMaintenance(t *testing.T) {
+	coll := setupEventsCollection(t)
+	doc, _ := MarshalDocument(map[string]any{"id": "b1", "tenant": "acme", "createdAt": 10})
+	assert.NoError(t, coll.Put(*doc))
+	assert.NoError(t, coll.Delete("a2"))
+	assert.Equal(t, []string{"b1", "a3", "a1"}, queryIDs(t, coll, "tenant,-createdAt", QueryParams{Prefix: []any{"acme"}}))
+	assert.Equal(t, []string{"b2"}, queryIDs(t, coll, "tenant,-createdAt", QueryParams{Prefix: []any{"beta"}}))
+}
+
+func TestCreateIndexWithConfig(t *testing.T) {
+	coll := setupEventsCollection(t)
+
+	tests := []struct {
+		name    string
+		cfg     IndexConfig
+		wantErr error
+	}{
+		{name: "no fields", cfg: IndexConfig{}, wantErr: ErrInvalidIndex},
+		{name: "empty field", cfg: IndexConfig{Fields: []IndexField{{Field: ""}}}, wantErr: ErrInvalidIndex},
+		{name: "duplicate field", cfg: IndexConfig{Fields: []IndexField{{Field: "a"}, {Field: "a", Desc: true}}}, wantErr: ErrInvalidIndex},
+		{name: "same default name", cfg: IndexConfig{Fields: []IndexField{{Field: "tenant"}, {Field: "createdAt", Desc: true}}}, wantErr: ErrIndexExists},
+		{name: "custom name", cfg: IndexConfig{Name: "by_tenant", Fields: []IndexField{{Field: "tenant"}, {Field: "createdAt", Desc: true}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := coll.CreateIndexWithConfig(tt.cfg)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, queryIDs(t, coll, tt.cfg.Name, QueryParams{}), 6)
+		})
+	}
+}
+
+func TestCompoundIndex_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	store, events := openUsers(t, dir, nil)
+	for _, e := range []map[string]any{
+		{"id": "a1", "tenant": "acme", "createdAt": 1},
+		{"id": "a2", "tenant": "acme", "createdAt": 2},
+	} {
+		doc, _ := MarshalDocument(e)
+		assert.NoError(t, events.Put(*doc))
+	}
+	cfg := IndexConfig{Fields: []IndexField{{Field: "tenant"}, {Field: "createdAt", Desc: true}}}
+	assert.NoError(t, events.CreateIndexWithConfig(cfg))
+	assert.NoError(t, events.CreateIndex("tenant"))
+
+	dump, err := store.Dump()
+	assert.NoError(t, err)
+	assert.Contains(t, string(dump), `"indexes":["tenant",{"fields":[{"field":"tenant"},{"field":"createdAt","desc":true}]}]`)
+	fromDump, err := NewStoreFromDump(dump)
+	assert.NoError(t, err)
+	col, _ := fromDump.GetCollection("users")
+	assert.Equal(t, []string{"a2", "a1"}, queryIDs(t, col, "tenant,-createdAt", QueryParams{Prefix: []any{"acme"}}))
+
+	assert.NoError(t, store.Close())
+	replayed, col := openUsers(t, dir, nil)
+	defer replayed.Close()
+	assert.Equal(t, []string{"a2", "a1"}, queryIDs(t, col, "tenant,-createdAt", QueryParams{Prefix: []any{"acme"}}))
+	assert.Equal(t, []string{"a1", "a2"}, queryIDs(t, col, "tenant", QueryParams{}))
+}
+
+func TestUniqueIndex(t *testing.T) {
+	coll := &Collection{
+		cfg:       CollectionConfig{PrimaryKey: "id"},
+		documents: map[string]Document{},
+	}
+	put := func(id string, email any) error {
+		fields := map[string]any{"id": id}
+		if email != nil {
+			fields["email"] = email
+		}
+		doc, _ := MarshalDocument(fields)
+		return coll.Put(*doc)
+	}
+	assert.NoError(t, put("1", "a@example.com"))
+	assert.NoError(t, coll.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "email"}}, Unique: true}))
+
+	assert.ErrorIs(t, put("2", "a@example.com"), ErrDuplicateKey)
+	_, err := coll.Get("2")
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+
+	assert.NoError(t, put("1", "a@example.com"), "a document does not conflict with itself")
+	assert.NoError(t, put("2", "b@example.com"))
+	assert.NoError(t, put("3", nil), "documents missing the field are not constrained")
+	assert.NoError(t, put("4", nil))
+
+	assert.NoError(t, put("1", "c@example.com"))
+	assert.NoError(t, put("5", "a@example.com"), "the old key is released on update")
+	assert.NoError(t, coll.Delete("5"))
+	assert.NoError(t, put("6", "a@example.com"), "the key is released on delete")
+	assert.Equal(t, []string{"6", "2", "1"}, queryIDs(t, coll, "email", QueryParams{}))
+}
+
+func TestUniqueIndex_ExistingViolation(t *testing.T) {
+	coll := setupEventsCollection(t)
+	err := coll.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "tenant"}}, Unique: true})
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+	_, err = coll.Query("tenant", QueryParams{})
+	assert.ErrorIs(t, err, ErrIndexNotFound)
+
+	assert.NoError(t, coll.CreateIndexWithConfig(IndexConfig{
+		Name:   "tenant_time",
+		Fields: []IndexField{{Field: "tenant"}, {Field: "createdAt"}},
+		Unique: true,
+	}))
+	doc, _ := MarshalDocument(map[string]any{"id": "a4", "tenant": "acme", "createdAt": 3})
+	assert.ErrorIs(t, coll.Put(*doc), ErrDuplicateKey)
+}
+
+func TestUniqueIndex_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	store, users := openUsers(t, dir, nil)
+	assert.NoError(t, users.Put(userDoc("1", "alice")))
+	assert.NoError(t, users.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "name"}}, Unique: true}))
+
+	dump, err := store.Dump()
+	assert.NoError(t, err)
+	assert.Contains(t, string(dump), `"indexes":[{"fields":[{"field":"name"}],"unique":true}]`)
+	fromDump, err := NewStoreFromDump(dump)
+	assert.NoError(t, err)
+	col, _ := fromDump.GetCollection("users")
+	assert.ErrorIs(t, col.Put(userDoc("2", "alice")), ErrDuplicateKey)
+
+	assert.NoError(t, store.Close())
+	replayed, col := openUsers(t, dir, nil)
+	defer replayed.Close()
+	assert.ErrorIs(t, col.Put(userDoc("2", "alice")), ErrDuplicateKey)
+}
+
+func setupTaggedCollection(t *testing.T) *Collection {
+	coll := &Collection{
+		cfg:       CollectionConfig{PrimaryKey: "id"},
+		documents: map[string]Document{},
+	}
+	for _, p := range []map[string]any{
+		{"id": "1", "tags": []any{"go", "db", "go"}, "kind": "post"},
+		{"id": "2", "tags": []string{"db"}, "kind": "note"},
+		{"id": "3", "tags": []any{}, "kind": "post"},
+		{"id": "4", "tags": []any{3, true, map[string]any{"x": 1}}, "kind": "post"},
+		{"id": "5", "kind": "post"},
+	} {
+		doc, _ := MarshalDocument(p)
+		assert.NoError(t, coll.Put(*doc))
+	}
+	assert.NoError(t, coll.CreateIndex("tags"))
+	return coll
+}
+
+func TestQuery_MultikeyIndex(t *testing.T) {
+	coll := setupTaggedCollection(t)
+	assert.NoError(t, coll.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "kind"}, {Field: "tags"}}}))
+
+	tests := []struct {
+		name   string
+		index  string
+		params QueryParams
+		want   []string
+	}{
+		{name: "element", index: "tags", params: QueryParams{MinValue: "db", MaxValue: "db"}, want: []string{"1", "2"}},
+		{name: "other element", index: "tags", params: QueryParams{MinValue: "go", MaxValue: "go"}, want: []string{"1"}},
+		{name: "number element", index: "tags", params: QueryParams{MinValue: 3, MaxValue: 3}, want: []string{"4"}},
+		{name: "bool element", index: "tags", params: QueryParams{MinValue: true}, want: []string{"4"}},
+		{name: "reported once", index: "tags", params: QueryParams{MinValue: "a"}, want: []string{"1", "2"}},
+		{name: "reported once reversed", index: "tags", params: QueryParams{MinValue: "a", Desc: true}, want: []string{"1", "2"}},
+		{name: "whole index", index: "tags", params: QueryParams{}, want: []string{"4", "1", "2"}}, // the empty array counts as null,
+		{name: "compound", index: "kind,tags", params: QueryParams{Prefix: []any{"post", "db"}}, want: []string{"1"}},
+		{name: "compound prefix", index: "kind,tags", params: QueryParams{Prefix: []any{"post"}}, want: []string{"3", "5", "4", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, queryIDs(t, coll, tt.index, tt.params))
+		})
+	}
+}
+
+func TestQuery_MultikeyIndexMaintenance(t *testing.T) {
+	coll := setupTaggedCollection(t)
+	doc, _ := MarshalDocument(map[string]any{"id": "1", "tags": []any{"rust"}})
+	assert.NoError(t, coll.Put(*doc))
+	assert.Equal(t, []string{"2"}, queryIDs(t, coll, "tags", QueryParams{MinValue: "db", MaxValue: "db"}))
+	assert.Equal(t, []string{}, queryIDs(t, coll, "tags", QueryParams{MinValue: "go", MaxValue: "go"}))
+	assert.Equal(t, []string{"1"}, queryIDs(t, coll, "tags", QueryParams{MinValue: "rust", MaxValue: "rust"}))
+
+	// Modifying the stored array in place must not leave stale entries.
+	tags := doc.Fields["tags"].Value.([]any)
+	tags[0] = "zig"
+	doc, _ = MarshalDocument(map[string]any{"id": "1", "tags": []any{"go"}})
+	assert.NoError(t, coll.Put(*doc))
+	assert.Equal(t, []string{}, queryIDs(t, coll, "tags", QueryParams{MinValue: "rust", MaxValue: "zig"}))
+
+	assert.NoError(t, coll.Delete("2"))
+	assert.Equal(t, []string{"1"}, queryIDs(t, coll, "tags", QueryParams{MinValue: "a"}))
+	assert.Equal(t, 3, coll.indexes["tags"].tree.Len())
+	assert.NoError(t, coll.Delete("1"))
+	assert.NoError(t, coll.Delete("3"))
+	assert.NoError(t, coll.Delete("4"))
+	assert.Equal(t, 0, coll.indexes["tags"].tree.Len())
+}
+
+func TestUniqueIndex_Multikey(t *testing.T) {
+	coll := setupTaggedCollection(t)
+	assert.NoError(t, coll.DeleteIndex("tags"))
+	assert.ErrorIs(t, coll.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "tags"}}, Unique: true}), ErrDuplicateKey)
+
+	assert.NoError(t, coll.Delete("2"))
+	assert.NoError(t, coll.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "tags"}}, Unique: true}))
+	doc, _ := MarshalDocument(map[string]any{"id": "6", "tags": []any{"rust", "go"}})
+	assert.ErrorIs(t, coll.Put(*doc), ErrDuplicateKey)
+	doc, _ = MarshalDocument(map[string]any{"id": "1", "tags": []any{"go", "go", "db"}})
+	assert.NoError(t, coll.Put(*doc))
+}
+
+func TestQuery_ExclusiveBounds(t *testing.T) {
+	coll := setupPeopleCollection(t)
+	assert.NoError(t, coll.CreateIndex("age"))
+	assert.NoError(t, coll.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "city"}, {Field: "age", Desc: true}}}))
+
+	tests := []struct {
+		name   string
+		index  string
+		params QueryParams
+		want   []string
+	}{
+		{name: "exclusive min", index: "age", params: QueryParams{MinValue: 30, MinExclusive: true}, want: []string{"3", "4"}},
+		{name: "exclusive max", index: "age", params: QueryParams{MaxValue: 30, MaxExclusive: true}, want: []string{"2"}},
+		{name: "both exclusive", index: "age", params: QueryParams{MinValue: 25, MaxValue: 40, MinExclusive: true, MaxExclusive: true}, want: []string{"1", "3"}},
+		{name: "both exclusive reversed", index: "age", params: QueryParams{MinValue: 25, MaxValue: 40, MinExclusive: true, MaxExclusive: true, Desc: true}, want: []string{"3", "1"}},
+		{name: "empty", index: "age", params: QueryParams{MinValue: 30, MaxValue: 30, MinExclusive: true}, want: []string{}},
+		{name: "descending field", index: "city,-age", params: QueryParams{Prefix: []any{"Kyiv"}, MinValue: 30, MinExclusive: true}, want: []string{"3"}},
+		{name: "descending field max", index: "city,-age", params: QueryParams{Prefix: []any{"Kyiv"}, MaxValue: 35, MaxExclusive: true}, want: []string{"1"}},
+		{name: "descending field reversed", index: "city,-age", params: QueryParams{Prefix: []any{"Kyiv"}, MinValue: 0, Desc: true}, want: []string{"1", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, queryIDs(t, coll, tt.index, tt.params))
+		})
+	}
+}
+
+func TestQuery_StartsWith(t *testing.T) {
+	coll := &Collection{
+		cfg:       CollectionConfig{PrimaryKey: "id"},
+		documents: map[string]Document{},
+	}
+	for _, u := range []map[string]any{
+		{"id": "1", "name": "John", "team": "a"},
+		{"id": "2", "name": "Jo", "team": "a"},
+		{"id": "3", "name": "Joanna", "team": "b"},
+		{"id": "4", "name": "Jp", "team": "a"},
+		{"id": "5", "name": "Jn", "team": "a"},
+		{"id": "6", "name": 10, "team": "a"},
+		{"id": "7", "name": "J\xff", "team": "a"},
+		{"id": "8", "name": "J\xff\xff", "team": "a"},
+	} {
+		doc, _ := MarshalDocument(u)
+		assert.NoError(t, coll.Put(*doc))
+	}
+	assert.NoError(t, coll.CreateIndex("name"))
+	assert.NoError(t, coll.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "team"}, {Field: "name", Desc: true}}}))
+
+	tests := []struct {
+		name   string
+		index  string
+		params QueryParams
+		want   []string
+	}{
+		{name: "prefix", index: "name", params: QueryParams{StartsWith: "Jo"}, want: []string{"2", "3", "1"}},
+		{name: "prefix reversed", index: "name", params: QueryParams{StartsWith: "Jo", Desc: true}, want: []string{"1", "3", "2"}},
+		{name: "whole key", index: "name", params: QueryParams{StartsWith: "John"}, want: []string{"1"}},
+		{name: "no match", index: "name", params: QueryParams{StartsWith: "Jz"}, want: []string{}},
+		{name: "trailing 0xff", index: "name", params: QueryParams{StartsWith: "J\xff"}, want: []string{"7", "8"}},
+		{name: "limit", index: "name", params: QueryParams{StartsWith: "J", Limit: 2}, want: []string{"5", "2"}},
+		{name: "after compound prefix", index: "team,-name", params: QueryParams{Prefix: []any{"a"}, StartsWith: "Jo"}, want: []string{"1", "2"}},
+		{name: "after compound prefix reversed", index: "team,-name", params: QueryParams{Prefix: []any{"a"}, StartsWith: "Jo", Desc: true}, want: []string{"2", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, queryIDs(t, coll, tt.index, tt.params))
+		})
+	}
+
+	_, err := coll.Query("name", QueryParams{StartsWith: "J", MinValue: "Ja"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = coll.Query("team,-name", QueryParams{Prefix: []any{"a", "John"}, StartsWith: "J"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestCompareKeys(t *testing.T) {
+	numbersEnd := typeEdge{rank: rankNumber, end: true}
+	stringsStart := typeEdge{rank: rankString}
+	assert.Equal(t, 1, compareKeys(numbersEnd, 1e300))
+	assert.Equal(t, -1, compareKeys(numbersEnd, ""))
+	assert.Equal(t, -1, compareKeys(stringsStart, ""))
+	assert.Equal(t, 1, compareKeys(stringsStart, 5.0))
+	assert.Equal(t, -1, compareKeys(numbersEnd, stringsStart))
+	assert.Equal(t, 0, compareKeys(stringsStart, stringsStart))
+	assert.Equal(t, 1, compareKeys("b", "a"))
+}
+
+func TestQuery_NaN(t *testing.T) {
+	c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+	assert.NoError(t, c.CreateIndex("score"))
+	for i, score := range []float64{math.NaN(), 4, 2, math.NaN(), 3} {
+		doc := userDoc(fmt.Sprint(i), "x")
+		doc.Fields["score"] = DocumentField{Type: DocumentFieldTypeNumber, Value: score}
+		assert.NoError(t, c.Put(doc))
+	}
+
+	docs, err := c.Query("score", QueryParams{MinValue: 2, MaxValue: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "4", "1"}, pageIDs(docs))
+
+	// NaN sorts before the other numbers, and its entries go with the
+	// documents.
+	docs, err = c.Query("score", QueryParams{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0", "3", "2", "4", "1"}, pageIDs(docs))
+	assert.NoError(t, c.Delete("0"))
+	assert.NoError(t, c.Delete("1"))
+	docs, err = c.Query("score", QueryParams{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "2", "4"}, pageIDs(docs))
+}
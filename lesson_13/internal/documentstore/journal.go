@@ -0,0 +1,453 @@
+package documentstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy controls when journal writes are flushed to stable storage.
+type SyncPolicy int
+
+const (
+	SyncAlways   SyncPolicy = iota // fsync after every record
+	SyncInterval                   // fsync in the background every StoreOptions.SyncInterval
+	SyncNever                      // leave flushing to the operating system
+)
+
+const (
+	journalFilePrefix = "journal-"
+	journalFileSuffix = ".log"
+	journalHeaderSize = 8 // uint32 payload length + uint32 CRC-32C of the payload
+	journalMaxRecord  = 64 << 20
+
+	defaultSyncInterval = 100 * time.Millisecond
+)
+
+var (
+	ErrJournalWrite   = errors.New("failed to write journal")
+	ErrJournalRead    = errors.New("failed to read journal")
+	ErrJournalCorrupt = errors.New("journal is corrupt")
+	ErrJournalClosed  = errors.New("journal is closed")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type journalOp string
+
+const (
+	opCreateCollection journalOp = "create_collection"
+	opDeleteCollection journalOp = "delete_collection"
+	opPut              journalOp = "put"
+	opDelete           journalOp = "delete"
+	opCreateIndex      journalOp = "create_index"
+	opDeleteIndex      journalOp = "delete_index"
+	opCreateTextIndex  journalOp = "create_text_index"
+	opTransaction      journalOp = "transaction" // puts and deletes in Ops, applied together
+)
+
+// journalRecord is a single logical change. Records are framed on disk as
+// a little-endian uint32 payload length, a CRC-32C of the payload and the
+// JSON encoded payload itself.
+type journalRecord struct {
+	LSN         uint64            `json:"lsn"`
+	Op          journalOp         `json:"op"`
+	Collection  string            `json:"collection"`
+	Config      *CollectionConfig `json:"config,omitempty"`
+	Document    *Document         `json:"document,omitempty"`
+	Key         string            `json:"key,omitempty"`
+	Index       string            `json:"index,omitempty"`
+	IndexConfig *IndexConfig      `json:"index_config,omitempty"`
+	TextIndex   *TextIndexConfig  `json:"text_index,omitempty"`
+	Ops         []journalRecord   `json:"ops,omitempty"`
+}
+
+// syncFile flushes a journal record to stable storage; tests replace it to
+// make syncs fail.
+var syncFile = (*os.File).Sync
+
+type journal struct {
+	mu     sync.Mutex
+	dir    string
+	path   string
+	f      *os.File
+	size   int64
+	lsn    uint64
+	policy SyncPolicy
+	dirty  bool
+	closed bool
+	failed error // a failed write that could not be undone
+	stop   chan struct{}
+	done   chan struct{}
+
+	// checkpoint is signalled once checkpointEvery records have been
+	// appended since the last rotation.
+	checkpoint      chan struct{}
+	checkpointEvery int
+	pending         int
+}
+
+func journalFileName(firstLSN uint64) string {
+	return fmt.Sprintf("%s%020d%s", journalFilePrefix, firstLSN, journalFileSuffix)
+}
+
+type journalSegment struct {
+	path  string
+	first uint64 // LSN of the first record in the segment
+}
+
+// journalSegments returns the journal files in dir ordered by their first LSN.
+func journalSegments(dir string) ([]journalSegment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []journalSegment
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, journalFilePrefix) || !strings.HasSuffix(name, journalFileSuffix) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, journalFilePrefix), journalFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, journalSegment{path: filepath.Join(dir, name), first: first})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].first < segments[j].first })
+	return segments, nil
+}
+
+// readJournal calls fn for every intact record of the journal file and
+// returns the offset just past the last one. A torn record at the end of the
+// file (short frame, or a checksum mismatch on the very last frame) is what
+// a crash in the middle of an append leaves behind, so it only stops the
+// scan. A checksum mismatch followed by more data means the file was damaged
+// and is reported as ErrJournalCorrupt.
+func readJournal(path string, fn func(rec journalRecord) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrJournalRead, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrJournalRead, err)
+	}
+	fileSize := info.Size()
+
+	var offset int64
+	header := make([]byte, journalHeaderSize)
+	for {
+		if _, err := io.ReadFull(f, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("%w: %w", ErrJournalRead, err)
+		}
+		length := binary.LittleEndian.Uint32(header[0:4])
+		sum := binary.LittleEndian.Uint32(header[4:8])
+		end := offset + journalHeaderSize + int64(length)
+		if length == 0 || length > journalMaxRecord || end > fileSize {
+			// The header is not checksummed, so a damaged length can point
+			// past the end of the file just like the header of a torn
+			// write does, or be 0 like a tail the crash left zero filled.
+			// Only the latter is the last frame of the file.
+			follows, err := frameFollows(f, offset, fileSize)
+			if err != nil {
+				return offset, err
+			}
+			if !follows {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("%w: invalid record length at offset %d", ErrJournalCorrupt, offset)
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(f, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("%w: %w", ErrJournalRead, err)
+		}
+		if crc32.Checksum(payload, crcTable) != sum {
+			if end == fileSize {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("%w: checksum mismatch at offset %d", ErrJournalCorrupt, offset)
+		}
+
+		var rec journalRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return offset, fmt.Errorf("%w: record at offset %d: %w", ErrJournalCorrupt, offset, err)
+		}
+		if err := fn(rec); err != nil {
+			return offset, err
+		}
+		offset = end
+	}
+}
+
+// frameFollows reports whether a complete frame with a valid checksum starts
+// anywhere in f after the frame at offset. Empty frames do not count: no
+// record is empty, and zero bytes would pass as one.
+func frameFollows(f *os.File, offset, fileSize int64) (bool, error) {
+	rest, err := io.ReadAll(io.NewSectionReader(f, offset+1, fileSize-offset-1))
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrJournalRead, err)
+	}
+	for p := 0; p+journalHeaderSize <= len(rest); p++ {
+		length := binary.LittleEndian.Uint32(rest[p : p+4])
+		if length == 0 || length > journalMaxRecord || int64(length) > int64(len(rest)-p-journalHeaderSize) {
+			continue
+		}
+		payload := rest[p+journalHeaderSize : p+journalHeaderSize+int(length)]
+		if crc32.Checksum(payload, crcTable) == binary.LittleEndian.Uint32(rest[p+4:p+8]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// openJournal opens path for appending, discarding anything past size.
+// lsn is the sequence number of the last record already in the journal.
+func openJournal(path string, size int64, lsn uint64, opts StoreOptions) (*journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrJournalWrite, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%w: %w", ErrJournalWrite, err)
+	}
+	if info.Size() > size {
+		l.Warn("truncating torn journal tail", slog.String("file", path), slog.Int64("size", info.Size()), slog.Int64("valid", size))
+		if err := f.Truncate(size); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("%w: %w", ErrJournalWrite, err)
+		}
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%w: %w", ErrJournalWrite, err)
+	}
+
+	j := &journal{
+		dir:    filepath.Dir(path),
+		path:   path,
+		f:      f,
+		size:   size,
+		lsn:    lsn,
+		policy: opts.Sync,
+	}
+	if j.policy == SyncInterval {
+		interval := opts.SyncInterval
+		if interval <= 0 {
+			interval = defaultSyncInterval
+		}
+		j.stop = make(chan struct{})
+		j.done = make(chan struct{})
+		go j.syncLoop(interval)
+	}
+	return j, nil
+}
+
+// append assigns the next LSN to rec and writes it to the journal.
+func (j *journal) append(rec *journalRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return ErrJournalClosed
+	}
+	if j.failed != nil {
+		return fmt.Errorf("%w: %w", ErrJournalWrite, j.failed)
+	}
+
+	rec.LSN = j.lsn + 1
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrJournalWrite, err)
+	}
+	if len(payload) > journalMaxRecord {
+		return fmt.Errorf("%w: record of %d bytes is too large", ErrJournalWrite, len(payload))
+	}
+
+	frame := make([]byte, journalHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	copy(frame[journalHeaderSize:], payload)
+
+	if _, err := j.f.Write(frame); err != nil {
+		j.discard()
+		return fmt.Errorf("%w: %w", ErrJournalWrite, err)
+	}
+	if j.policy == SyncAlways {
+		if err := syncFile(j.f); err != nil {
+			// The record was not applied, so it must not be replayed
+			// either, nor share its LSN with the next one.
+			j.discard()
+			return fmt.Errorf("%w: %w", ErrJournalWrite, err)
+		}
+	} else {
+		j.dirty = true
+	}
+
+	j.size += int64(len(frame))
+	j.lsn = rec.LSN
+	j.pending++
+	if j.checkpoint != nil && j.pending >= j.checkpointEvery {
+		select {
+		case j.checkpoint <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// discard drops whatever part of the last frame made it to the file, so
+// that the next record does not end up behind a torn or unsynced one. If
+// that fails too, the file no longer matches size and lsn and the journal
+// refuses further records.
+func (j *journal) discard() {
+	err := j.f.Truncate(j.size)
+	if err == nil {
+		_, err = j.f.Seek(j.size, io.SeekStart)
+	}
+	if err != nil {
+		l.Error("journal discard error", slog.String("error", err.Error()))
+		j.failed = err
+	}
+}
+
+// rotate closes the current segment and starts a new one beginning right
+// after the last written record, whose LSN is returned. Everything up to that
+// LSN lives in older segments that can be dropped once a snapshot covers it.
+func (j *journal) rotate() (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return 0, ErrJournalClosed
+	}
+	if j.failed != nil {
+		return 0, fmt.Errorf("%w: %w", ErrJournalWrite, j.failed)
+	}
+	path := filepath.Join(j.dir, journalFileName(j.lsn+1))
+	if path == j.path {
+		// Nothing was written since the last rotation.
+		return j.lsn, nil
+	}
+
+	// The segment is complete on disk before the next one exists: only the
+	// last segment may end in a torn record.
+	if err := syncFile(j.f); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrJournalWrite, err)
+	}
+	_ = j.f.Close()
+	j.dirty = false
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err == nil {
+		if err = syncDir(j.dir); err != nil {
+			_ = f.Close()
+			_ = os.Remove(path)
+		}
+	}
+	if err != nil {
+		j.reopen()
+		return 0, fmt.Errorf("%w: %w", ErrJournalWrite, err)
+	}
+
+	j.f, j.path, j.size = f, path, 0
+	j.dirty, j.pending = false, 0
+	return j.lsn, nil
+}
+
+// reopen goes back to appending to the current segment after a failed
+// rotation closed it. If that fails too, the journal refuses further
+// records.
+func (j *journal) reopen() {
+	f, err := os.OpenFile(j.path, os.O_RDWR, 0644)
+	if err == nil {
+		if _, err = f.Seek(j.size, io.SeekStart); err != nil {
+			_ = f.Close()
+		}
+	}
+	if err != nil {
+		l.Error("journal reopen error", slog.String("error", err.Error()))
+		j.failed = err
+		return
+	}
+	j.f = f
+}
+
+func (j *journal) syncLoop(interval time.Duration) {
+	defer close(j.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			j.syncDirty()
+		}
+	}
+}
+
+// syncDirty syncs the records appended since the last sync, if any.
+func (j *journal) syncDirty() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.dirty || j.closed || j.failed != nil {
+		return
+	}
+	if err := syncFile(j.f); err != nil {
+		l.Error("journal sync error", slog.String("error", err.Error()))
+		return
+	}
+	j.dirty = false
+}
+
+func (j *journal) close() error {
+	if j.stop != nil {
+		close(j.stop)
+		<-j.done
+		j.stop = nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return nil
+	}
+	j.closed = true
+	if j.failed != nil {
+		// The file holds a record that could not be undone, or is closed
+		// already after a failed rotation.
+		_ = j.f.Close()
+		return nil
+	}
+	if err := j.f.Sync(); err != nil {
+		_ = j.f.Close()
+		return fmt.Errorf("%w: %w", ErrJournalWrite, err)
+	}
+	return j.f.Close()
+}
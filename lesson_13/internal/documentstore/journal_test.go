@@ -0,0 +1,367 @@
+package documentstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func userDoc(id, name string) Document {
+	return Document{Fields: map[string]DocumentField{
+		"id":   {Type: DocumentFieldTypeString, Value: id},
+		"name": {Type: DocumentFieldTypeString, Value: name},
+	}}
+}
+
+func journalPath(t *testing.T, dir string) string {
+	segments, err := journalSegments(dir)
+	if err != nil || len(segments) == 0 {
+		t.Fatalf("no journal segments in %s: %v", dir, err)
+	}
+	return segments[len(segments)-1].path
+}
+
+func TestOpenStore_ReplaysJournal(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, users.Put(userDoc("1", "Alice")))
+	assert.NoError(t, users.Put(userDoc("2", "Bob")))
+	assert.NoError(t, users.Put(userDoc("2", "Bobby")))
+	assert.NoError(t, users.Put(userDoc("3", "Charlie")))
+	assert.NoError(t, users.Delete("3"))
+	assert.NoError(t, users.CreateIndex("name"))
+	assert.NoError(t, users.CreateIndex("id"))
+	assert.NoError(t, users.DeleteIndex("id"))
+	_, _ = store.CreateCollection("tmp", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, store.DeleteCollection("tmp"))
+	assert.NoError(t, store.Close())
+
+	restored, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer restored.Close()
+
+	_, err = restored.GetCollection("tmp")
+	assert.ErrorIs(t, err, ErrCollectionNotFound)
+
+	col, err := restored.GetCollection("users")
+	if err != nil {
+		t.Fatalf("GetCollection() error = %v", err)
+	}
+	assert.Len(t, col.List(), 2)
+	doc, err := col.Get("2")
+	assert.NoError(t, err)
+	assert.Equal(t, "Bobby", doc.Fields["name"].Value)
+	_, err = col.Get("3")
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+
+	docs, err := col.Query("name", QueryParams{})
+	assert.NoError(t, err)
+	assert.Len(t, docs, 2)
+	_, err = col.Query("id", QueryParams{})
+	assert.ErrorIs(t, err, ErrIndexNotFound)
+
+	// New writes continue the journal.
+	assert.NoError(t, col.Put(userDoc("4", "Dave")))
+	assert.NoError(t, restored.Close())
+	again, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer again.Close()
+	col, _ = again.GetCollection("users")
+	assert.Len(t, col.List(), 3)
+}
+
+func TestOpenStore_TruncatedTail(t *testing.T) {
+	dir := t.TempDir()
+
+	store, _ := OpenStore(dir, nil)
+	users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, users.Put(userDoc("1", "Alice")))
+	assert.NoError(t, users.Put(userDoc("2", "Bob")))
+	assert.NoError(t, store.Close())
+
+	path := journalPath(t, dir)
+	info, _ := os.Stat(path)
+	// Cut the last record in half, as a crash in the middle of a write would.
+	assert.NoError(t, os.Truncate(path, info.Size()-5))
+
+	restored, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	col, _ := restored.GetCollection("users")
+	assert.Len(t, col.List(), 1)
+
+	// The torn tail is discarded so later appends are readable.
+	assert.NoError(t, col.Put(userDoc("3", "Charlie")))
+	assert.NoError(t, restored.Close())
+
+	again, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer again.Close()
+	col, _ = again.GetCollection("users")
+	_, err = col.Get("3")
+	assert.NoError(t, err)
+	_, err = col.Get("2")
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+}
+
+func TestOpenStore_ZeroFilledTail(t *testing.T) {
+	for _, n := range []int{8, 40, 4096} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			dir := t.TempDir()
+			store, _ := OpenStore(dir, nil)
+			users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+			assert.NoError(t, users.Put(userDoc("1", "Alice")))
+			assert.NoError(t, store.Close())
+
+			// A crash can leave the space of an append zero filled.
+			f, err := os.OpenFile(journalPath(t, dir), os.O_APPEND|os.O_WRONLY, 0644)
+			assert.NoError(t, err)
+			_, err = f.Write(make([]byte, n))
+			assert.NoError(t, err)
+			assert.NoError(t, f.Close())
+
+			restored, err := OpenStore(dir, nil)
+			if err != nil {
+				t.Fatalf("OpenStore() error = %v", err)
+			}
+			col, _ := restored.GetCollection("users")
+			assert.NoError(t, col.Put(userDoc("2", "Bob")))
+			assert.NoError(t, restored.Close())
+
+			again, err := OpenStore(dir, nil)
+			if err != nil {
+				t.Fatalf("OpenStore() error = %v", err)
+			}
+			defer again.Close()
+			col, _ = again.GetCollection("users")
+			assert.Len(t, col.List(), 2)
+		})
+	}
+}
+
+func TestOpenStore_ChecksumMismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+		wantErr error
+		wantLen int
+	}{
+		{
+			name: "damaged last record is treated as torn",
+			corrupt: func(data []byte) []byte {
+				data[len(data)-2] ^= 0xff
+				return data
+			},
+			wantLen: 1,
+		},
+		{
+			name: "damaged length pointing past the end",
+			corrupt: func(data []byte) []byte {
+				binary.LittleEndian.PutUint32(data[0:4], uint32(len(data)))
+				return data
+			},
+			wantErr: ErrJournalCorrupt,
+		},
+		{
+			name: "damaged length beyond the record limit",
+			corrupt: func(data []byte) []byte {
+				binary.LittleEndian.PutUint32(data[0:4], math.MaxUint32)
+				return data
+			},
+			wantErr: ErrJournalCorrupt,
+		},
+		{
+			name: "damaged record in the middle",
+			corrupt: func(data []byte) []byte {
+				data[journalHeaderSize+2] ^= 0xff
+				return data
+			},
+			wantErr: ErrJournalCorrupt,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, _ := OpenStore(dir, nil)
+			users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+			assert.NoError(t, users.Put(userDoc("1", "Alice")))
+			assert.NoError(t, users.Put(userDoc("2", "Bob")))
+			assert.NoError(t, store.Close())
+
+			path := journalPath(t, dir)
+			data, _ := os.ReadFile(path)
+			assert.NoError(t, os.WriteFile(path, tt.corrupt(data), 0644))
+
+			restored, err := OpenStore(dir, nil)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenStore() error = %v", err)
+			}
+			defer restored.Close()
+			col, _ := restored.GetCollection("users")
+			assert.Len(t, col.List(), tt.wantLen)
+		})
+	}
+}
+
+func TestOpenStore_SyncPolicies(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        SyncPolicy
+		wantOnWrite   int // syncs by the two writes
+		wantOnTick    int // syncs by the next two ticks of the sync loop
+		wantSyncsLoop bool
+	}{
+		{name: "always", policy: SyncAlways, wantOnWrite: 2},
+		{name: "interval", policy: SyncInterval, wantOnTick: 1, wantSyncsLoop: true},
+		{name: "never", policy: SyncNever},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var syncs int
+			syncFile = func(f *os.File) error {
+				syncs++
+				return f.Sync()
+			}
+			defer func() { syncFile = (*os.File).Sync }()
+
+			// The loop's own ticker never fires; the test ticks it instead.
+			dir := t.TempDir()
+			store, err := OpenStore(dir, &StoreOptions{Sync: tt.policy, SyncInterval: time.Hour})
+			if err != nil {
+				t.Fatalf("OpenStore() error = %v", err)
+			}
+			users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+			assert.NoError(t, users.Put(userDoc("1", "Alice")))
+			assert.Equal(t, tt.wantOnWrite, syncs)
+			assert.Equal(t, tt.wantSyncsLoop, store.journal.stop != nil)
+			if tt.wantSyncsLoop {
+				store.journal.syncDirty()
+				store.journal.syncDirty()
+			}
+			assert.Equal(t, tt.wantOnWrite+tt.wantOnTick, syncs)
+			assert.NoError(t, store.Close())
+
+			restored, err := OpenStore(dir, nil)
+			if err != nil {
+				t.Fatalf("OpenStore() error = %v", err)
+			}
+			col, _ := restored.GetCollection("users")
+			assert.Len(t, col.List(), 1)
+			assert.NoError(t, restored.Close())
+		})
+	}
+}
+
+func TestStore_Close(t *testing.T) {
+	store, _ := OpenStore(filepath.Join(t.TempDir(), "db"), nil)
+	users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, store.Close())
+
+	assert.ErrorIs(t, users.Put(userDoc("1", "Alice")), ErrJournalClosed)
+	assert.Empty(t, users.List())
+	_, err := store.CreateCollection("other", &CollectionConfig{PrimaryKey: "id"})
+	assert.ErrorIs(t, err, ErrJournalClosed)
+	assert.NoError(t, NewStore().Close())
+}
+
+func TestStore_DeleteCollectionDetachesJournal(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := OpenStore(dir, nil)
+	old, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, store.DeleteCollection("users"))
+	_, _ = store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, old.Put(userDoc("1", "Alice")))
+	assert.NoError(t, store.Close())
+
+	restored, _ := OpenStore(dir, nil)
+	defer restored.Close()
+	col, _ := restored.GetCollection("users")
+	assert.Empty(t, col.List())
+}
+
+func TestStore_DeleteCollectionConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := OpenStore(dir, nil)
+	users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = users.Put(userDoc(fmt.Sprint(i%10), "x"))
+			_ = users.CreateIndex("name")
+		}
+	}()
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, store.DeleteCollection("users"))
+	time.Sleep(5 * time.Millisecond)
+	close(stop)
+	<-done
+	assert.NoError(t, store.Close())
+
+	// No write of the detached collection follows the deletion record.
+	restored, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer restored.Close()
+	_, err = restored.GetCollection("users")
+	assert.ErrorIs(t, err, ErrCollectionNotFound)
+}
+
+func TestStore_JournalSyncFailure(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, users.Put(userDoc("1", "Alice")))
+
+	syncFile = func(*os.File) error { return os.ErrInvalid }
+	err = users.Put(userDoc("2", "Bob"))
+	syncFile = (*os.File).Sync
+	assert.ErrorIs(t, err, ErrJournalWrite)
+	_, err = users.Get("2")
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+
+	// The failed record is gone and its LSN is reused.
+	assert.NoError(t, users.Put(userDoc("3", "Carol")))
+	assert.NoError(t, store.Close())
+
+	restored, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer restored.Close()
+	col, _ := restored.GetCollection("users")
+	assert.Equal(t, []string{"1", "3"}, pageIDs(col.List()))
+}
@@ -0,0 +1,195 @@
+package documentstore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page is one page of a Query or List. Cursor is empty on the last page;
+// otherwise passing it back in QueryParams.Cursor returns the next page.
+type Page struct {
+	Documents []Document
+	Cursor    string
+}
+
+// cursor marks a position in an index or, without Index, in primary key
+// order, or in a sorted read of either. It is handed to clients base64
+// encoded and is opaque to them.
+type cursor struct {
+	Index  string `json:"i,omitempty"`
+	Sorted bool   `json:"s,omitempty"` // Keys are the values of QueryParams.Sort
+	Keys   []any  `json:"k,omitempty"`
+	PK     string `json:"p"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return cursor{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	if c.PK == "" {
+		return cursor{}, fmt.Errorf("%w: no primary key", ErrInvalidCursor)
+	}
+	return c, nil
+}
+
+func validatePage(params QueryParams) error {
+	if params.Skip < 0 || params.Limit < 0 {
+		return fmt.Errorf("%w: negative skip or limit", ErrInvalidQuery)
+	}
+	return params.Projection.validate()
+}
+
+// QueryPage returns a page of the documents in the given range of the named
+// index. The cursor records the index key and primary key of the last
+// document, so the next page starts right after it even if documents were
+// written in between: deleted documents are not repeated and documents
+// inserted before the cursor are not returned. With params.Sort the
+// documents in the range are returned in that order instead, and the cursor
+// records their sort values.
+func (s *Collection) QueryPage(indexName string, params QueryParams) (Page, error) {
+	return s.Snapshot().QueryPage(indexName, params)
+}
+
+// QueryPage is Collection.QueryPage on the snapshot.
+func (sn *Snapshot) QueryPage(indexName string, params QueryParams) (Page, error) {
+	if err := validatePage(params); err != nil {
+		return Page{}, err
+	}
+	return sn.queryPage(indexName, params, nil)
+}
+
+// queryPage implements QueryPage, counting its work in stats if not nil.
+// The caller must have validated params.
+func (sn *Snapshot) queryPage(indexName string, params QueryParams, stats *Explain) (Page, error) {
+	idx, ok := sn.indexes[indexName]
+	if !ok {
+		return Page{}, ErrIndexNotFound
+	}
+	if stats != nil {
+		stats.Index = indexName
+		stats.Bounds = []IndexBounds{boundsOf(params)}
+	}
+
+	if len(params.Sort) > 0 {
+		rng := params
+		rng.Cursor = ""
+		return sn.sortedPage(indexName, params, func(fn func(pk string, doc Document)) error {
+			return idx.scan(rng, func(item *indexItem) bool {
+				stats.examineKey()
+				stats.examineDoc()
+				doc, _ := sn.document(item.pk)
+				fn(item.pk, doc)
+				return true
+			})
+		})
+	}
+
+	page := Page{Documents: []Document{}}
+	var last *indexItem
+	skip := params.Skip
+	err := idx.scan(params, func(item *indexItem) bool {
+		stats.examineKey()
+		if skip > 0 {
+			skip--
+			return true
+		}
+		if params.Limit > 0 && len(page.Documents) == params.Limit {
+			// There is at least one more document.
+			page.Cursor = cursor{Index: indexName, Keys: last.keys, PK: last.pk}.encode()
+			return false
+		}
+		stats.examineDoc()
+		doc, _ := sn.document(item.pk)
+		page.Documents = append(page.Documents, params.Projection.apply(doc, sn.cfg.PrimaryKey))
+		last = item
+		return true
+	})
+	if err != nil {
+		return Page{}, err
+	}
+	return page, nil
+}
+
+// ListPage returns a page of the documents in primary key order, or in
+// reverse with params.Desc, or in the order of params.Sort. Prefixes and
+// bounds do not apply.
+func (s *Collection) ListPage(params QueryParams) (Page, error) {
+	return s.Snapshot().ListPage(params)
+}
+
+// ListPage is Collection.ListPage on the snapshot.
+func (sn *Snapshot) ListPage(params QueryParams) (Page, error) {
+	if err := validatePage(params); err != nil {
+		return Page{}, err
+	}
+	if len(params.Prefix) > 0 || params.MinValue != nil || params.MaxValue != nil ||
+		params.MinExclusive || params.MaxExclusive || params.StartsWith != "" {
+		return Page{}, fmt.Errorf("%w: list takes no prefix or bounds", ErrInvalidQuery)
+	}
+	if len(params.Sort) > 0 {
+		return sn.sortedPage("", params, func(fn func(pk string, doc Document)) error {
+			sn.docs.Ascend(func(e *docEntry) bool {
+				fn(e.pk, e.doc)
+				return true
+			})
+			return nil
+		})
+	}
+
+	var after string
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		if c.Index != "" || c.Sorted {
+			return Page{}, fmt.Errorf("%w: not a list cursor", ErrInvalidCursor)
+		}
+		after = c.PK
+	}
+
+	page := Page{Documents: []Document{}}
+	var last string
+	skip := params.Skip
+	visit := func(e *docEntry) bool {
+		switch {
+		case after != "" && e.pk == after:
+			return true
+		case skip > 0:
+			skip--
+			return true
+		case params.Limit > 0 && len(page.Documents) == params.Limit:
+			// There is at least one more document.
+			page.Cursor = cursor{PK: last}.encode()
+			return false
+		}
+		page.Documents = append(page.Documents, params.Projection.apply(e.doc, sn.cfg.PrimaryKey))
+		last = e.pk
+		return true
+	}
+	switch {
+	case params.Desc && after != "":
+		sn.docs.DescendLessOrEqual(&docEntry{pk: after}, visit)
+	case params.Desc:
+		sn.docs.Descend(visit)
+	case after != "":
+		sn.docs.AscendGreaterOrEqual(&docEntry{pk: after}, visit)
+	default:
+		sn.docs.Ascend(visit)
+	}
+	return page, nil
+}
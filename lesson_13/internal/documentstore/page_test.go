@@ -0,0 +1,172 @@
+package documentstore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pageIDs(docs []Document) []string {
+	ids := []string{}
+	for _, d := range docs {
+		ids = append(ids, d.Fields["id"].Value.(string))
+	}
+	return ids
+}
+
+// collectPages follows the cursors of fetch and returns the pages it got.
+func collectPages(t *testing.T, fetch func(cursor string) (Page, error)) [][]string {
+	var pages [][]string
+	cursor := ""
+	for i := 0; i < 20; i++ {
+		page, err := fetch(cursor)
+		if !assert.NoError(t, err) {
+			return pages
+		}
+		pages = append(pages, pageIDs(page.Documents))
+		if page.Cursor == "" {
+			return pages
+		}
+		cursor = page.Cursor
+	}
+	t.Fatal("cursor never ended")
+	return nil
+}
+
+func TestQueryPage(t *testing.T) {
+	coll := setupPeopleCollection(t)
+	assert.NoError(t, coll.CreateIndex("age"))
+
+	tests := []struct {
+		name   string
+		params QueryParams
+		want   [][]string
+	}{
+		{name: "pages", params: QueryParams{Limit: 2}, want: [][]string{{"2", "1"}, {"3", "4"}}},
+		{name: "pages reversed", params: QueryParams{Limit: 3, Desc: true}, want: [][]string{{"4", "3", "1"}, {"2"}}},
+		{name: "skip", params: QueryParams{Skip: 1, Limit: 2}, want: [][]string{{"1", "3"}, {"4"}}},
+		{name: "bounds", params: QueryParams{MinValue: 26, Limit: 1}, want: [][]string{{"1"}, {"3"}, {"4"}}},
+		{name: "no limit", params: QueryParams{}, want: [][]string{{"2", "1", "3", "4"}}},
+		{name: "exact fit", params: QueryParams{Limit: 4}, want: [][]string{{"2", "1", "3", "4"}}},
+		{name: "skip everything", params: QueryParams{Skip: 10}, want: [][]string{{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectPages(t, func(cursor string) (Page, error) {
+				params := tt.params
+				params.Cursor = cursor
+				if cursor != "" {
+					params.Skip = 0
+				}
+				return coll.QueryPage("age", params)
+			})
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQueryPage_ConcurrentWrites(t *testing.T) {
+	coll := setupPeopleCollection(t)
+	assert.NoError(t, coll.CreateIndex("age"))
+
+	page, err := coll.QueryPage("age", QueryParams{Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "1"}, pageIDs(page.Documents))
+
+	// Delete the document the cursor points at and insert one before and
+	// one after it.
+	assert.NoError(t, coll.Delete("1"))
+	for id, age := range map[string]int{"6": 20, "7": 33} {
+		doc, _ := MarshalDocument(map[string]any{"id": id, "age": age})
+		assert.NoError(t, coll.Put(*doc))
+	}
+	page, err = coll.QueryPage("age", QueryParams{Limit: 2, Cursor: page.Cursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"7", "3"}, pageIDs(page.Documents))
+}
+
+func TestQueryPage_Multikey(t *testing.T) {
+	coll := &Collection{
+		cfg:       CollectionConfig{PrimaryKey: "id"},
+		documents: map[string]Document{},
+	}
+	for i, tags := range [][]any{{"a", "c"}, {"b"}, {"a", "b", "d"}} {
+		doc, _ := MarshalDocument(map[string]any{"id": fmt.Sprint(i + 1), "tags": tags})
+		assert.NoError(t, coll.Put(*doc))
+	}
+	assert.NoError(t, coll.CreateIndex("tags"))
+
+	for _, desc := range []bool{false, true} {
+		got := collectPages(t, func(cursor string) (Page, error) {
+			return coll.QueryPage("tags", QueryParams{Limit: 1, Desc: desc, Cursor: cursor})
+		})
+		if desc {
+			assert.Equal(t, [][]string{{"3"}, {"1"}, {"2"}}, got)
+		} else {
+			assert.Equal(t, [][]string{{"1"}, {"3"}, {"2"}}, got)
+		}
+	}
+	got := collectPages(t, func(cursor string) (Page, error) {
+		return coll.QueryPage("tags", QueryParams{MinValue: "b", Limit: 1, Cursor: cursor})
+	})
+	assert.Equal(t, [][]string{{"2"}, {"3"}, {"1"}}, got)
+}
+
+func TestQueryPage_Invalid(t *testing.T) {
+	coll := setupPeopleCollection(t)
+	assert.NoError(t, coll.CreateIndex("age"))
+	assert.NoError(t, coll.CreateIndex("name"))
+
+	_, err := coll.QueryPage("age", QueryParams{Limit: -1})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+
+	// An empty page encodes as [] like an empty list page, not null.
+	for _, params := range []QueryParams{{MinValue: 1000}, {MinValue: 1000, Sort: []SortField{{Field: "name"}}}} {
+		page, err := coll.QueryPage("age", params)
+		assert.NoError(t, err)
+		assert.Equal(t, []Document{}, page.Documents)
+	}
+	_, err = coll.QueryPage("age", QueryParams{Cursor: "not a cursor!"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	page, err := coll.QueryPage("name", QueryParams{Limit: 1})
+	assert.NoError(t, err)
+	_, err = coll.QueryPage("age", QueryParams{Cursor: page.Cursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = coll.ListPage(QueryParams{Cursor: page.Cursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	for _, params := range []QueryParams{
+		{MinValue: "1"},
+		{MinExclusive: true},
+		{MaxExclusive: true},
+		{StartsWith: "1"},
+	} {
+		_, err = coll.ListPage(params)
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+	}
+}
+
+func TestListPage(t *testing.T) {
+	coll := setupPeopleCollection(t)
+
+	got := collectPages(t, func(cursor string) (Page, error) {
+		return coll.ListPage(QueryParams{Limit: 2, Cursor: cursor})
+	})
+	assert.Equal(t, [][]string{{"1", "2"}, {"3", "4"}, {"5"}}, got)
+
+	got = collectPages(t, func(cursor string) (Page, error) {
+		return coll.ListPage(QueryParams{Limit: 3, Desc: true, Cursor: cursor})
+	})
+	assert.Equal(t, [][]string{{"5", "4", "3"}, {"2", "1"}}, got)
+
+	page, err := coll.ListPage(QueryParams{Skip: 1, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "3"}, pageIDs(page.Documents))
+
+	assert.NoError(t, coll.Delete("3"))
+	page, err = coll.ListPage(QueryParams{Cursor: page.Cursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4", "5"}, pageIDs(page.Documents))
+	assert.Empty(t, page.Cursor)
+}
@@ -0,0 +1,256 @@
+package documentstore
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Lookup returns the field at a dotted path such as "address.city". Every
+// segment but the last must name an object: a nested Document or *Document,
+// a map with string keys or a struct, whose exported fields are matched by
+// name. If an intermediate value is missing or is not an object, the field
+// is reported as missing. A top-level field whose name contains dots is
+// matched as a whole before the path is split.
+//
+// Nested Documents come back from JSON as {"Fields": {...}} maps; a map
+// holding only a "Fields" object is therefore read as an encoded Document.
+func (d Document) Lookup(path string) (DocumentField, bool) {
+	if field, ok := d.Fields[path]; ok {
+		return field, true
+	}
+
+	var field DocumentField
+	var value any = d
+	for _, name := range strings.Split(path, ".") {
+		f, ok := member(value, name)
+		if !ok {
+			return DocumentField{}, false
+		}
+		field, value = f, f.Value
+	}
+	return field, true
+}
+
+// member returns the named member of an object value.
+func member(v any, name string) (DocumentField, bool) {
+	switch v := v.(type) {
+	case Document:
+		f, ok := v.Fields[name]
+		return f, ok
+	case *Document:
+		if v == nil {
+			return DocumentField{}, false
+		}
+		f, ok := v.Fields[name]
+		return f, ok
+	case map[string]any:
+		if fields, ok := encodedDocument(v); ok {
+			raw, ok := fields[name].(map[string]any)
+			if !ok {
+				return DocumentField{}, false
+			}
+			t, _ := raw["Type"].(string)
+			return DocumentField{Type: DocumentFieldType(t), Value: raw["Value"]}, t != ""
+		}
+		raw, ok := v[name]
+		if !ok {
+			return DocumentField{}, false
+		}
+		return fieldOf(raw)
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return DocumentField{}, false
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		f := rv.FieldByName(name)
+		if !f.IsValid() || !f.CanInterface() {
+			return DocumentField{}, false
+		}
+		return fieldOf(f.Interface())
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return DocumentField{}, false
+		}
+		f := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !f.IsValid() {
+			return DocumentField{}, false
+		}
+		return fieldOf(f.Interface())
+	}
+	return DocumentField{}, false
+}
+
+// encodedDocument returns the fields of a Document decoded from JSON into a
+// plain map.
+func encodedDocument(m map[string]any) (map[string]any, bool) {
+	if len(m) != 1 {
+		return nil, false
+	}
+	fields, ok := m["Fields"].(map[string]any)
+	return fields, ok
+}
+
+// fieldOf wraps a plain Go value in a DocumentField of the matching type.
+// Nil values and values of unsupported kinds are reported as missing.
+func fieldOf(v any) (DocumentField, bool) {
+	if f, ok := v.(DocumentField); ok {
+		return f, true
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return DocumentField{}, false
+		}
+		rv = rv.Elem()
+	}
+
+	var t DocumentFieldType
+	switch rv.Kind() {
+	case reflect.String:
+		t = DocumentFieldTypeString
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		t = DocumentFieldTypeNumber
+	case reflect.Bool:
+		t = DocumentFieldTypeBool
+	case reflect.Slice, reflect.Array:
+		t = DocumentFieldTypeArray
+	case reflect.Struct, reflect.Map:
+		t = DocumentFieldTypeObject
+	default:
+		return DocumentField{}, false
+	}
+	return DocumentField{Type: t, Value: v}, true
+}
+
+// validPath reports whether path has no empty segments.
+func validPath(path string) bool {
+	for _, name := range strings.Split(path, ".") {
+		if name == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// asDocument converts an object value to a Document. Members of maps and
+// structs are wrapped with fieldOf.
+func asDocument(v any) (Document, bool) {
+	switch v := v.(type) {
+	case Document:
+		return v, true
+	case *Document:
+		if v == nil {
+			return Document{}, false
+		}
+		return *v, true
+	case map[string]any:
+		if fields, ok := encodedDocument(v); ok {
+			doc := Document{Fields: make(map[string]DocumentField, len(fields))}
+			for name := range fields {
+				if f, ok := member(v, name); ok {
+					doc.Fields[name] = f
+				}
+			}
+			return doc, true
+		}
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return Document{}, false
+		}
+		rv = rv.Elem()
+	}
+	doc := Document{Fields: make(map[string]DocumentField)}
+	switch rv.Kind() {
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if name := rv.Type().Field(i).Name; rv.Field(i).CanInterface() {
+				if f, ok := fieldOf(rv.Field(i).Interface()); ok {
+					doc.Fields[name] = f
+				}
+			}
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return Document{}, false
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			if f, ok := fieldOf(iter.Value().Interface()); ok {
+				doc.Fields[iter.Key().String()] = f
+			}
+		}
+	default:
+		return Document{}, false
+	}
+	return doc, true
+}
+
+// withField returns a copy of d with the field at path set to f. As in
+// Lookup, a top-level field named like the whole path takes precedence.
+// Objects along the path are copied into nested Documents; missing
+// intermediates and ones that are not objects are replaced by empty
+// Documents. d itself is not modified.
+func (d Document) withField(path string, f DocumentField) Document {
+	name, rest, nested := strings.Cut(path, ".")
+	out := Document{Fields: make(map[string]DocumentField, len(d.Fields)+1), Revision: d.Revision}
+	for k, v := range d.Fields {
+		out.Fields[k] = v
+	}
+	if _, ok := d.Fields[path]; ok || !nested {
+		out.Fields[path] = f
+		return out
+	}
+	inner, ok := Document{}, false
+	if cur, exists := d.Fields[name]; exists {
+		inner, ok = asDocument(cur.Value)
+	}
+	if !ok {
+		inner = Document{Fields: map[string]DocumentField{}}
+	}
+	out.Fields[name] = DocumentField{Type: DocumentFieldTypeObject, Value: inner.withField(rest, f)}
+	return out
+}
+
+// withoutField returns a copy of d without the field at path, and whether
+// there was one. As in Lookup, a top-level field named like the whole path
+// takes precedence. Objects along the path are copied into nested
+// Documents; d itself is not modified.
+func (d Document) withoutField(path string) (Document, bool) {
+	name, rest, nested := strings.Cut(path, ".")
+	if _, ok := d.Fields[path]; ok || !nested {
+		if !ok {
+			return d, false
+		}
+		out := Document{Fields: make(map[string]DocumentField, len(d.Fields)), Revision: d.Revision}
+		for k, v := range d.Fields {
+			if k != path {
+				out.Fields[k] = v
+			}
+		}
+		return out, true
+	}
+	cur, ok := d.Fields[name]
+	if !ok {
+		return d, false
+	}
+	inner, ok := asDocument(cur.Value)
+	if !ok {
+		return d, false
+	}
+	inner, ok = inner.withoutField(rest)
+	if !ok {
+		return d, false
+	}
+	return d.withField(name, DocumentField{Type: DocumentFieldTypeObject, Value: inner}), true
+}
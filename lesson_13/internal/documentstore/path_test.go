@@ -0,0 +1,120 @@
+package documentstore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testAddress struct {
+	City string
+	Zip  int
+	note string
+}
+
+func nestedDoc() Document {
+	inner := Document{Fields: map[string]DocumentField{
+		"city": {Type: DocumentFieldTypeString, Value: "Kyiv"},
+	}}
+	return Document{Fields: map[string]DocumentField{
+		"id":       {Type: DocumentFieldTypeString, Value: "1"},
+		"name":     {Type: DocumentFieldTypeString, Value: "alice"},
+		"a.b":      {Type: DocumentFieldTypeString, Value: "dotted"},
+		"home":     {Type: DocumentFieldTypeObject, Value: inner},
+		"work":     {Type: DocumentFieldTypeObject, Value: &inner},
+		"meta":     {Type: DocumentFieldTypeObject, Value: map[string]any{"city": "Lviv", "geo": map[string]any{"lat": 49.8}}},
+		"postal":   {Type: DocumentFieldTypeObject, Value: testAddress{City: "Odesa", Zip: 65000, note: "x"}},
+		"tags":     {Type: DocumentFieldTypeArray, Value: []any{"a"}},
+		"nullable": {Type: DocumentFieldTypeObject, Value: nil},
+	}}
+}
+
+func TestDocument_Lookup(t *testing.T) {
+	doc := nestedDoc()
+	roundTripped := Document{}
+	data, _ := json.Marshal(doc)
+	assert.NoError(t, json.Unmarshal(data, &roundTripped))
+
+	tests := []struct {
+		name   string
+		path   string
+		want   any
+		wantOk bool
+	}{
+		{name: "top level", path: "name", want: "alice", wantOk: true},
+		{name: "dotted top-level name", path: "a.b", want: "dotted", wantOk: true},
+		{name: "nested document", path: "home.city", want: "Kyiv", wantOk: true},
+		{name: "nested document pointer", path: "work.city", want: "Kyiv", wantOk: true},
+		{name: "map", path: "meta.city", want: "Lviv", wantOk: true},
+		{name: "map in map", path: "meta.geo.lat", want: 49.8, wantOk: true},
+		{name: "struct", path: "postal.City", want: "Odesa", wantOk: true},
+		{name: "unexported struct field", path: "postal.note"},
+		{name: "missing leaf", path: "home.street"},
+		{name: "missing intermediate", path: "office.city"},
+		{name: "scalar intermediate", path: "name.first"},
+		{name: "array intermediate", path: "tags.0"},
+		{name: "nil intermediate", path: "nullable.city"},
+		{name: "empty segment", path: "home..city"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field, ok := doc.Lookup(tt.path)
+			assert.Equal(t, tt.wantOk, ok)
+			if tt.wantOk {
+				assert.Equal(t, tt.want, normalizeValue(field.Value))
+			}
+
+			// The same paths resolve once the document went through JSON.
+			field, ok = roundTripped.Lookup(tt.path)
+			assert.Equal(t, tt.wantOk, ok)
+			if tt.wantOk {
+				assert.Equal(t, tt.want, normalizeValue(field.Value))
+			}
+		})
+	}
+
+	field, _ := doc.Lookup("postal.Zip")
+	assert.Equal(t, DocumentFieldTypeNumber, field.Type)
+	field, _ = roundTripped.Lookup("home")
+	assert.Equal(t, DocumentFieldTypeObject, field.Type)
+}
+
+func TestQuery_NestedPath(t *testing.T) {
+	coll := &Collection{
+		cfg:       CollectionConfig{PrimaryKey: "id"},
+		documents: map[string]Document{},
+	}
+	for _, u := range []map[string]any{
+		{"id": "1", "address": map[string]any{"city": "Lviv"}},
+		{"id": "2", "address": testAddress{City: "Kyiv"}},
+		{"id": "3", "address": "unknown"},
+		{"id": "4"},
+	} {
+		doc, _ := MarshalDocument(u)
+		assert.NoError(t, coll.Put(*doc))
+	}
+	assert.NoError(t, coll.CreateIndex("address.city"))
+	assert.NoError(t, coll.CreateIndex("address.City"))
+	assert.ErrorIs(t, coll.CreateIndex("address."), ErrInvalidIndex)
+
+	assert.Equal(t, []string{"1"}, queryIDs(t, coll, "address.city", QueryParams{}))
+	assert.Equal(t, []string{"2"}, queryIDs(t, coll, "address.City", QueryParams{MinValue: "K"}))
+
+	nested := Document{Fields: map[string]DocumentField{
+		"id":      {Type: DocumentFieldTypeString, Value: "5"},
+		"address": {Type: DocumentFieldTypeObject, Value: Document{Fields: map[string]DocumentField{"city": {Type: DocumentFieldTypeString, Value: "Dnipro"}}}},
+	}}
+	assert.NoError(t, coll.Put(nested))
+	assert.Equal(t, []string{"5", "1"}, queryIDs(t, coll, "address.city", QueryParams{}))
+
+	store := NewStore()
+	store.collections["people"] = coll
+	dump, err := store.Dump()
+	assert.NoError(t, err)
+	restored, err := NewStoreFromDump(dump)
+	assert.NoError(t, err)
+	col, _ := restored.GetCollection("people")
+	assert.Equal(t, []string{"5", "1"}, queryIDs(t, col, "address.city", QueryParams{}))
+	assert.Equal(t, []string{"2"}, queryIDs(t, col, "address.City", QueryParams{}))
+}
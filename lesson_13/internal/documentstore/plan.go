@@ -0,0 +1,238 @@
+package documentstore
+
+import (
+	"sort"
+)
+
+// maxPlanScans caps the number of index ranges an in filter expands to.
+const maxPlanScans = 64
+
+// queryPlan describes how the documents a filter may match are read: a set
+// of ranges of one index, or every document when index is nil. The filter
+// is still applied to each document read, so a plan only has to select a
+// superset of the matches.
+type queryPlan struct {
+	index *index
+	scans []QueryParams
+}
+
+// plan picks the index whose ranges, derived from the predicates and-ed at
+// the top of f, hold the fewest entries, preferring the one constraining
+// more fields on a tie. Indexes are only used for eq, in and range filters
+// on scalar values; anything else is left to the filter. The entries
+// counted are added to stats if not nil.
+func (sn *Snapshot) plan(f Filter, stats *Explain) queryPlan {
+	preds := conjuncts(f, nil)
+
+	names := make([]string, 0, len(sn.indexes))
+	for name := range sn.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	best := queryPlan{}
+	bestCount, bestFields := sn.docs.Len(), 0
+	for _, name := range names {
+		idx := sn.indexes[name]
+		scans, fields := planIndex(idx, preds)
+		if fields == 0 {
+			continue
+		}
+		// Count the entries in the ranges, giving up as soon as the index
+		// is worse than the best one so far.
+		count := 0
+		for _, params := range scans {
+			_ = idx.scan(params, func(*indexItem) bool {
+				stats.examinePlanKey()
+				count++
+				return count <= bestCount
+			})
+			if count > bestCount {
+				break
+			}
+		}
+		if count < bestCount || count == bestCount && fields > bestFields {
+			best, bestCount, bestFields = queryPlan{index: idx, scans: scans}, count, fields
+		}
+	}
+	return best
+}
+
+// conjuncts appends the comparison filters f is the conjunction of.
+func conjuncts(f Filter, preds []Filter) []Filter {
+	if f.Op == FilterAnd {
+		for _, sub := range f.Filters {
+			preds = conjuncts(sub, preds)
+		}
+		return preds
+	}
+	return append(preds, f)
+}
+
+// planIndex turns the predicates into ranges of idx: eq and in filters on
+// the leading fields become the prefix, range filters on the next field the
+// bounds. It returns the number of fields constrained, zero if the first
+// field is not.
+func planIndex(idx *index, preds []Filter) ([]QueryParams, int) {
+	prefixes := [][]any{{}}
+	var bounds QueryParams
+
+	for _, field := range idx.cfg.Fields {
+		if value, ok := findPredicate(preds, field.Field, FilterEq); ok {
+			for i := range prefixes {
+				prefixes[i] = append(prefixes[i], value)
+			}
+			continue
+		}
+		if values, ok := findIn(preds, field.Field); ok && len(prefixes)*len(values) <= maxPlanScans {
+			next := make([][]any, 0, len(prefixes)*len(values))
+			for _, prefix := range prefixes {
+				for _, v := range values {
+					next = append(next, append(prefix[:len(prefix):len(prefix)], v))
+				}
+			}
+			prefixes = next
+			continue
+		}
+
+		for _, op := range []FilterOp{FilterGt, FilterGte} {
+			if v, ok := findPredicate(preds, field.Field, op); ok {
+				bounds.MinValue, bounds.MinExclusive = v, op == FilterGt
+			}
+		}
+		for _, op := range []FilterOp{FilterLt, FilterLte} {
+			if v, ok := findPredicate(preds, field.Field, op); ok {
+				bounds.MaxValue, bounds.MaxExclusive = v, op == FilterLt
+			}
+		}
+		// Array elements may satisfy each bound separately, so a multikey
+		// index can only apply one of them.
+		if idx.multikey && bounds.MinValue != nil {
+			bounds.MaxValue, bounds.MaxExclusive = nil, false
+		}
+		break
+	}
+
+	fields := len(prefixes[0])
+	if bounds.MinValue != nil || bounds.MaxValue != nil {
+		fields++
+	}
+	if fields == 0 {
+		return nil, 0
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return idx.less(&indexItem{keys: prefixes[i]}, &indexItem{keys: prefixes[j]})
+	})
+	scans := make([]QueryParams, len(prefixes))
+	for i, prefix := range prefixes {
+		scans[i] = bounds
+		scans[i].Prefix = prefix
+	}
+	return scans, fields
+}
+
+// findPredicate returns the normalized operand of a filter with the given
+// operator on field, if it can bound an index.
+func findPredicate(preds []Filter, field string, op FilterOp) (any, bool) {
+	for _, p := range preds {
+		if p.Op != op || p.Field != field {
+			continue
+		}
+		if v := normalizeValue(p.Value); indexable(v) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func findIn(preds []Filter, field string) ([]any, bool) {
+	for _, p := range preds {
+		if p.Op != FilterIn || p.Field != field || len(p.Values) == 0 {
+			continue
+		}
+		values := make([]any, 0, len(p.Values))
+		for _, v := range p.Values {
+			v = normalizeValue(v)
+			if !indexable(v) {
+				return nil, false
+			}
+			values = append(values, v)
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// indexable reports whether v is a value index keys can hold. Nulls are
+// left out because documents missing every indexed field have no entry.
+func indexable(v any) bool {
+	switch v.(type) {
+	case string, float64, bool:
+		return true
+	}
+	return false
+}
+
+// find calls fn, until it returns false, for the documents matching f in
+// the order of the chosen index, or of primary keys for a full scan. Its
+// work is counted in stats if not nil. The caller must have validated f.
+func (sn *Snapshot) find(f Filter, stats *Explain, fn func(pk string, doc Document) bool) {
+	plan := sn.plan(f, stats)
+	if stats != nil && plan.index != nil {
+		stats.Index = plan.index.cfg.name()
+		for _, params := range plan.scans {
+			stats.Bounds = append(stats.Bounds, boundsOf(params))
+		}
+	}
+	if plan.index == nil {
+		sn.docs.Ascend(func(e *docEntry) bool {
+			stats.examineDoc()
+			return !f.match(e.doc) || fn(e.pk, e.doc)
+		})
+		return
+	}
+
+	seen := make(map[string]bool)
+	stop := false
+	for _, params := range plan.scans {
+		_ = plan.index.scan(params, func(item *indexItem) bool {
+			stats.examineKey()
+			if len(plan.scans) > 1 {
+				if seen[item.pk] {
+					return true
+				}
+				seen[item.pk] = true
+			}
+			stats.examineDoc()
+			doc, _ := sn.document(item.pk)
+			if f.match(doc) && !fn(item.pk, doc) {
+				stop = true
+			}
+			return !stop
+		})
+		if stop {
+			return
+		}
+	}
+}
+
+// Find returns the documents matching filter. It reads them through the
+// index that narrows the search the most, in that index's order, or scans
+// the whole collection in primary key order when no index applies.
+func (s *Collection) Find(filter Filter) ([]Document, error) {
+	return s.Snapshot().Find(filter)
+}
+
+// Find is Collection.Find on the snapshot.
+func (sn *Snapshot) Find(filter Filter) ([]Document, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	var result []Document
+	sn.find(filter, nil, func(_ string, doc Document) bool {
+		result = append(result, doc)
+		return true
+	})
+	return result, nil
+}
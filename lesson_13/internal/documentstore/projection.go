@@ -0,0 +1,190 @@
+package documentstore
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Projection narrows the documents returned by a read to some of their
+// fields. Include keeps only the fields at the given dotted paths, plus the
+// primary key; Exclude keeps everything else. The two cannot be combined.
+// Objects along a path keep their representation: nested Documents stay
+// Documents and maps stay maps, while structs become maps of their exported
+// fields. An included path leading into an object that lacks the field
+// leaves that object empty.
+type Projection struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+func (p *Projection) validate() error {
+	if p == nil {
+		return nil
+	}
+	if len(p.Include) > 0 && len(p.Exclude) > 0 {
+		return fmt.Errorf("%w: a projection either includes or excludes fields", ErrInvalidQuery)
+	}
+	for _, path := range append(p.Include[:len(p.Include):len(p.Include)], p.Exclude...) {
+		if !validPath(path) {
+			return fmt.Errorf("%w: invalid projection path %q", ErrInvalidQuery, path)
+		}
+	}
+	return nil
+}
+
+// pathTree holds projection paths split into their segments; a nil subtree
+// marks the end of a path, which covers everything below it.
+type pathTree map[string]pathTree
+
+func (t pathTree) add(path string) {
+	name, rest, nested := strings.Cut(path, ".")
+	sub, exists := t[name]
+	switch {
+	case exists && sub == nil:
+		// A shorter path already covers this one.
+	case !nested:
+		t[name] = nil // replaces any longer paths
+	default:
+		if !exists {
+			sub = pathTree{}
+			t[name] = sub
+		}
+		sub.add(rest)
+	}
+}
+
+// apply returns the projected copy of doc. A nil or empty projection
+// returns doc itself.
+func (p *Projection) apply(doc Document, primaryKey string) Document {
+	if p == nil || len(p.Include) == 0 && len(p.Exclude) == 0 {
+		return doc
+	}
+
+	// As in Lookup, top-level fields named like a whole path come first;
+	// they are looked up by their full name.
+	paths := append(p.Include[:len(p.Include):len(p.Include)], p.Exclude...)
+	tree := pathTree{}
+	for _, path := range paths {
+		if _, ok := doc.Fields[path]; ok {
+			tree[path] = nil
+		} else {
+			tree.add(path)
+		}
+	}
+
+	include := len(p.Include) > 0
+	out := Document{Fields: projectFields(doc.Fields, tree, include), Revision: doc.Revision}
+	if f, ok := doc.Fields[primaryKey]; ok && include {
+		out.Fields[primaryKey] = f
+	}
+	return out
+}
+
+// projectFields returns the fields of an object kept by tree.
+func projectFields(fields map[string]DocumentField, tree pathTree, include bool) map[string]DocumentField {
+	out := make(map[string]DocumentField)
+	if !include {
+		for name, f := range fields {
+			out[name] = f
+		}
+	}
+	for name, sub := range tree {
+		f, ok := fields[name]
+		switch {
+		case !ok:
+		case sub == nil && include:
+			out[name] = f
+		case sub == nil:
+			delete(out, name)
+		default:
+			if v, ok := projectValue(f.Value, sub, include); ok {
+				out[name] = DocumentField{Type: f.Type, Value: v}
+			} else {
+				delete(out, name)
+			}
+		}
+	}
+	return out
+}
+
+// projectValue applies tree to an object value. Values that are not objects
+// are dropped by include projections and kept by exclude ones.
+func projectValue(v any, tree pathTree, include bool) (any, bool) {
+	switch obj := v.(type) {
+	case Document:
+		return Document{Fields: projectFields(obj.Fields, tree, include)}, true
+	case *Document:
+		if obj != nil {
+			return Document{Fields: projectFields(obj.Fields, tree, include)}, true
+		}
+	case map[string]any:
+		if _, ok := encodedDocument(obj); ok {
+			doc, _ := asDocument(obj)
+			return Document{Fields: projectFields(doc.Fields, tree, include)}, true
+		}
+		return projectMap(obj, tree, include), true
+	default:
+		if m, ok := plainMap(v); ok {
+			return projectMap(m, tree, include), true
+		}
+	}
+	return v, !include
+}
+
+func projectMap(m map[string]any, tree pathTree, include bool) map[string]any {
+	out := make(map[string]any)
+	if !include {
+		for name, v := range m {
+			out[name] = v
+		}
+	}
+	for name, sub := range tree {
+		v, ok := m[name]
+		switch {
+		case !ok:
+		case sub == nil && include:
+			out[name] = v
+		case sub == nil:
+			delete(out, name)
+		default:
+			if pv, ok := projectValue(v, sub, include); ok {
+				out[name] = pv
+			} else {
+				delete(out, name)
+			}
+		}
+	}
+	return out
+}
+
+// plainMap converts a struct or a map with string keys to a map[string]any.
+func plainMap(v any) (map[string]any, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	m := make(map[string]any)
+	switch rv.Kind() {
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if rv.Field(i).CanInterface() {
+				m[rv.Type().Field(i).Name] = rv.Field(i).Interface()
+			}
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = iter.Value().Interface()
+		}
+	default:
+		return nil, false
+	}
+	return m, true
+}
@@ -0,0 +1,132 @@
+package documentstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjection_Apply(t *testing.T) {
+	doc := nestedDoc()
+	inner := Document{Fields: map[string]DocumentField{}}
+
+	tests := []struct {
+		name       string
+		projection *Projection
+		want       map[string]DocumentField
+	}{
+		{
+			name:       "nil",
+			projection: nil,
+			want:       doc.Fields,
+		},
+		{
+			name:       "include keeps the primary key",
+			projection: &Projection{Include: []string{"name", "missing"}},
+			want: map[string]DocumentField{
+				"id":   doc.Fields["id"],
+				"name": doc.Fields["name"],
+			},
+		},
+		{
+			name:       "include nested paths",
+			projection: &Projection{Include: []string{"a.b", "home.city", "work.street", "meta.geo.lat", "postal.City", "name.first"}},
+			want: map[string]DocumentField{
+				"id":     doc.Fields["id"],
+				"a.b":    doc.Fields["a.b"],
+				"home":   {Type: DocumentFieldTypeObject, Value: doc.Fields["home"].Value},
+				"work":   {Type: DocumentFieldTypeObject, Value: inner},
+				"meta":   {Type: DocumentFieldTypeObject, Value: map[string]any{"geo": map[string]any{"lat": 49.8}}},
+				"postal": {Type: DocumentFieldTypeObject, Value: map[string]any{"City": "Odesa"}},
+			},
+		},
+		{
+			name:       "shorter path wins",
+			projection: &Projection{Include: []string{"meta.city", "meta"}},
+			want: map[string]DocumentField{
+				"id":   doc.Fields["id"],
+				"meta": doc.Fields["meta"],
+			},
+		},
+		{
+			name:       "exclude",
+			projection: &Projection{Exclude: []string{"id", "a.b", "home.city", "meta.geo", "postal.Zip", "tags.0", "nullable", "missing.path"}},
+			want: map[string]DocumentField{
+				"name":   doc.Fields["name"],
+				"home":   {Type: DocumentFieldTypeObject, Value: inner},
+				"work":   doc.Fields["work"],
+				"meta":   {Type: DocumentFieldTypeObject, Value: map[string]any{"city": "Lviv"}},
+				"postal": {Type: DocumentFieldTypeObject, Value: map[string]any{"City": "Odesa"}},
+				"tags":   doc.Fields["tags"],
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.projection.apply(doc, "id")
+			assert.Equal(t, tt.want, got.Fields)
+			assert.Equal(t, nestedDoc(), doc, "the source document must not change")
+		})
+	}
+}
+
+func TestProjection_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		projection *Projection
+		wantErr    bool
+	}{
+		{name: "nil"},
+		{name: "empty", projection: &Projection{}},
+		{name: "include", projection: &Projection{Include: []string{"a", "b.c"}}},
+		{name: "exclude", projection: &Projection{Exclude: []string{"a"}}},
+		{name: "both", projection: &Projection{Include: []string{"a"}, Exclude: []string{"b"}}, wantErr: true},
+		{name: "invalid path", projection: &Projection{Exclude: []string{"a..b"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.projection.validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidQuery)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCollection_Projection(t *testing.T) {
+	coll := setupOrdersCollection(t)
+	assert.NoError(t, coll.CreateIndex("customer"))
+	cities := &Projection{Include: []string{"shipping.city"}}
+
+	doc, err := coll.GetProjected("1", *cities)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"id": "1", "shipping": map[string]any{"city": "Kyiv"}}}, plain([]Document{*doc}))
+
+	_, err = coll.GetProjected("missing", *cities)
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+
+	docs, err := coll.Query("customer", QueryParams{MinValue: "bob", Projection: &Projection{Exclude: []string{"items", "shipping"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{
+		{"id": "2", "customer": "bob", "total": 25.5},
+		{"id": "5", "customer": "bob", "total": 30.0},
+		{"id": "4", "customer": "carol", "total": "n/a"},
+	}, plain(docs))
+
+	page, err := coll.ListPage(QueryParams{Limit: 2, Projection: &Projection{Include: []string{"customer"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{
+		{"id": "1", "customer": "alice"},
+		{"id": "2", "customer": "bob"},
+	}, plain(page.Documents))
+
+	_, err = coll.ListPage(QueryParams{Projection: &Projection{Include: []string{"a"}, Exclude: []string{"b"}}})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+
+	// The stored documents keep all their fields.
+	doc, err = coll.Get("1")
+	assert.NoError(t, err)
+	assert.Len(t, doc.Fields, 5)
+}
@@ -0,0 +1,148 @@
+package documentstore
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func revisionOf(t *testing.T, c *Collection, key string) uint64 {
+	doc, err := c.Get(key)
+	if err != nil {
+		t.Fatalf("Get(%q) error = %v", key, err)
+	}
+	return doc.Revision
+}
+
+func TestCollection_Revision(t *testing.T) {
+	c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+
+	doc := userDoc("1", "Alice")
+	doc.Revision = 42 // ignored
+	assert.NoError(t, c.Put(doc))
+	assert.Equal(t, uint64(1), revisionOf(t, c, "1"))
+	assert.NoError(t, c.Put(userDoc("1", "Alicia")))
+	assert.Equal(t, uint64(2), revisionOf(t, c, "1"))
+
+	// Every read returns the revision.
+	assert.Equal(t, uint64(2), c.List()[0].Revision)
+	got, err := c.GetProjected("1", Projection{Include: []string{"name"}})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), got.Revision)
+	page, err := c.ListPage(QueryParams{Projection: &Projection{Exclude: []string{"name"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), page.Documents[0].Revision)
+
+	// A document put again after a delete does not reuse a revision, so a
+	// write made against the deleted one fails.
+	assert.NoError(t, c.Delete("1"))
+	assert.NoError(t, c.Put(userDoc("1", "Alice")))
+	assert.Equal(t, uint64(3), revisionOf(t, c, "1"))
+	assert.ErrorIs(t, c.PutIfRevision(userDoc("1", "Stale"), 1), ErrRevisionConflict)
+	assert.ErrorIs(t, c.DeleteIfRevision("1", 2), ErrRevisionConflict)
+
+	// Revisions go up across the documents of a collection.
+	assert.NoError(t, c.Put(userDoc("2", "Bob")))
+	assert.Equal(t, uint64(4), revisionOf(t, c, "2"))
+}
+
+func TestCollection_PutIfRevision(t *testing.T) {
+	c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+
+	assert.NoError(t, c.PutIfRevision(userDoc("1", "Alice"), 0))
+	assert.ErrorIs(t, c.PutIfRevision(userDoc("1", "Alice"), 0), ErrRevisionConflict)
+	assert.ErrorIs(t, c.PutIfRevision(userDoc("2", "Bob"), 1), ErrRevisionConflict)
+
+	assert.NoError(t, c.PutIfRevision(userDoc("1", "Alicia"), 1))
+	assert.ErrorIs(t, c.PutIfRevision(userDoc("1", "Ally"), 1), ErrRevisionConflict)
+	doc, _ := c.Get("1")
+	assert.Equal(t, "Alicia", doc.Fields["name"].Value)
+	assert.Equal(t, uint64(2), doc.Revision)
+}
+
+func TestCollection_DeleteIfRevision(t *testing.T) {
+	c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+	assert.NoError(t, c.Put(userDoc("1", "Alice")))
+	assert.NoError(t, c.Put(userDoc("1", "Alicia")))
+
+	assert.ErrorIs(t, c.DeleteIfRevision("2", 1), ErrDocumentNotFound)
+	assert.ErrorIs(t, c.DeleteIfRevision("1", 1), ErrRevisionConflict)
+	assert.Len(t, c.List(), 1)
+	assert.NoError(t, c.DeleteIfRevision("1", 2))
+	assert.Len(t, c.List(), 0)
+}
+
+func TestStore_RevisionPersists(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	active, _ := setupAccounts(t, store)
+	assert.NoError(t, active.Put(userDoc("1", "Alicia")))
+	tx := store.Begin()
+	assert.NoError(t, tx.Put("active", userDoc("2", "Bobby")))
+	assert.NoError(t, tx.Put("archived", userDoc("1", "Alice")))
+	assert.NoError(t, tx.Commit())
+	assert.Equal(t, uint64(4), revisionOf(t, active, "2"))
+	assert.NoError(t, store.Close())
+
+	// Replaying the journal restores the revisions.
+	restored, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer restored.Close()
+	active, _ = restored.GetCollection("active")
+	archived, _ := restored.GetCollection("archived")
+	assert.Equal(t, uint64(3), revisionOf(t, active, "1"))
+	assert.Equal(t, uint64(4), revisionOf(t, active, "2"))
+	assert.Equal(t, uint64(1), revisionOf(t, archived, "1"))
+
+	// So does a dump.
+	var buf bytes.Buffer
+	assert.NoError(t, restored.DumpTo(&buf))
+	loaded, err := NewStoreFromReader(&buf)
+	assert.NoError(t, err)
+	active, _ = loaded.GetCollection("active")
+	assert.Equal(t, uint64(3), revisionOf(t, active, "1"))
+	assert.ErrorIs(t, active.PutIfRevision(userDoc("1", "Al"), 1), ErrRevisionConflict)
+	assert.NoError(t, active.PutIfRevision(userDoc("1", "Al"), 3))
+}
+
+func TestStore_RevisionSurvivesDelete(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, users.Put(userDoc("1", "Alice")))
+	assert.NoError(t, users.Put(userDoc("2", "Bob")))
+	assert.NoError(t, users.Put(userDoc("2", "Bobby")))
+	assert.NoError(t, users.Delete("2"))
+	assert.NoError(t, store.Close())
+
+	// Replaying the journal keeps the revisions of deleted documents used.
+	restored, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer restored.Close()
+	users, _ = restored.GetCollection("users")
+	assert.NoError(t, users.Put(userDoc("2", "Bob")))
+	assert.Equal(t, uint64(4), revisionOf(t, users, "2"))
+	assert.ErrorIs(t, users.PutIfRevision(userDoc("2", "Stale"), 2), ErrRevisionConflict)
+
+	// So does a dump, although no document is left at the highest one.
+	assert.NoError(t, users.Delete("2"))
+	var buf bytes.Buffer
+	assert.NoError(t, restored.DumpTo(&buf))
+	loaded, err := NewStoreFromReader(&buf)
+	assert.NoError(t, err)
+	users, _ = loaded.GetCollection("users")
+	assert.NoError(t, users.Put(userDoc("2", "Bob")))
+	assert.Equal(t, uint64(5), revisionOf(t, users, "2"))
+	assert.ErrorIs(t, users.PutIfRevision(userDoc("2", "Stale"), 4), ErrRevisionConflict)
+}
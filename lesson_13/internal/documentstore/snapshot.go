@@ -0,0 +1,98 @@
+package documentstore
+
+import (
+	"github.com/google/btree"
+)
+
+// Snapshot is a read-only view of a collection as it was when the snapshot
+// was taken. Reading it takes no locks, so long scans do not hold up writers
+// and see none of their writes.
+//
+// Snapshots are cheap: the documents and the indexes are kept in B-trees
+// that a snapshot shares with the collection. A write to the collection
+// copies the nodes it changes instead of modifying them, leaving the old
+// versions to the snapshots still referring to them; the garbage collector
+// frees them once the last such snapshot is gone. Text indexes are not part
+// of snapshots.
+type Snapshot struct {
+	cfg     CollectionConfig
+	docs    *btree.BTreeG[*docEntry]
+	indexes map[string]*index
+}
+
+type docEntry struct {
+	pk  string
+	doc Document
+}
+
+func lessDocEntry(a, b *docEntry) bool {
+	return a.pk < b.pk
+}
+
+// Snapshot returns a snapshot of the collection. List, Query, Find and the
+// other reads over many documents run on one, so they only hold the read
+// lock while it is taken. Snapshots taken with no write in between are the
+// same.
+func (s *Collection) Snapshot() *Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.snapshot()
+}
+
+// snapshot implements Snapshot. The caller must hold the read or the write
+// lock.
+func (s *Collection) snapshot() *Snapshot {
+	// Cloning a B-tree modifies it, so readers take turns.
+	s.snapMu.Lock()
+	defer s.snapMu.Unlock()
+
+	if s.snap != nil {
+		return s.snap
+	}
+	if s.primary == nil {
+		s.primary = btree.NewG(8, lessDocEntry)
+		for pk, doc := range s.documents {
+			s.primary.ReplaceOrInsert(&docEntry{pk: pk, doc: doc})
+		}
+	}
+	snap := &Snapshot{
+		cfg:     s.cfg,
+		docs:    s.primary.Clone(),
+		indexes: make(map[string]*index, len(s.indexes)),
+	}
+	for name, idx := range s.indexes {
+		snap.indexes[name] = idx.clone()
+	}
+	s.snap = snap
+	return snap
+}
+
+// document returns the document stored under pk.
+func (sn *Snapshot) document(pk string) (Document, bool) {
+	if e, ok := sn.docs.Get(&docEntry{pk: pk}); ok {
+		return e.doc, true
+	}
+	return Document{}, false
+}
+
+func (sn *Snapshot) Get(key string) (*Document, error) {
+	if doc, ok := sn.document(key); ok {
+		return &doc, nil
+	}
+	return nil, ErrDocumentNotFound
+}
+
+// List returns all documents in primary key order.
+func (sn *Snapshot) List() []Document {
+	documents := make([]Document, 0, sn.docs.Len())
+	sn.docs.Ascend(func(e *docEntry) bool {
+		documents = append(documents, e.doc)
+		return true
+	})
+	return documents
+}
+
+// Len returns the number of documents.
+func (sn *Snapshot) Len() int {
+	return sn.docs.Len()
+}
@@ -0,0 +1,112 @@
+package documentstore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot_PointInTime(t *testing.T) {
+	coll := setupPeopleCollection(t)
+	assert.NoError(t, coll.CreateIndex("city"))
+
+	sn := coll.Snapshot()
+	assert.Same(t, sn, coll.Snapshot(), "no writes, same snapshot")
+
+	doc, _ := MarshalDocument(map[string]any{"id": "6", "name": "frank", "city": "Kyiv"})
+	assert.NoError(t, coll.Put(*doc))
+	doc, _ = MarshalDocument(map[string]any{"id": "1", "name": "alice", "city": "Lviv"})
+	assert.NoError(t, coll.Put(*doc))
+	assert.NoError(t, coll.Delete("2"))
+	assert.NoError(t, coll.DeleteIndex("city"))
+	assert.NoError(t, coll.CreateIndex("name"))
+
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, pageIDs(sn.List()))
+	assert.Equal(t, 5, sn.Len())
+	got, err := sn.Get("2")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", got.Fields["name"].Value)
+	_, err = sn.Get("6")
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+
+	page, err := sn.QueryPage("city", QueryParams{Prefix: []any{"Kyiv"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "3", "5"}, pageIDs(page.Documents))
+	_, err = sn.QueryPage("name", QueryParams{})
+	assert.ErrorIs(t, err, ErrIndexNotFound)
+	docs, err := sn.Find(Eq("city", "Lviv"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, pageIDs(docs))
+	page, err = sn.ListPage(QueryParams{Desc: true, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"5", "4"}, pageIDs(page.Documents))
+
+	now := coll.Snapshot()
+	assert.NotSame(t, sn, now)
+	assert.Equal(t, []string{"1", "3", "4", "5", "6"}, pageIDs(now.List()))
+	docs, err = now.Find(Eq("city", "Lviv"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, pageIDs(docs))
+}
+
+func TestSnapshot_ScanDoesNotBlockWriters(t *testing.T) {
+	coll := setupPeopleCollection(t)
+	assert.NoError(t, coll.CreateIndex("city"))
+
+	// Writing from inside a scan would deadlock if the scan held the lock.
+	var seen []string
+	coll.Snapshot().find(Filter{Op: FilterAnd}, nil, func(pk string, _ Document) bool {
+		seen = append(seen, pk)
+		doc, _ := MarshalDocument(map[string]any{"id": "new" + pk, "city": "Kyiv"})
+		assert.NoError(t, coll.Put(*doc))
+		assert.NoError(t, coll.Delete(pk))
+		return true
+	})
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, seen)
+	assert.Equal(t, []string{"new1", "new2", "new3", "new4", "new5"}, pageIDs(coll.List()))
+}
+
+func TestSnapshot_Concurrent(t *testing.T) {
+	coll := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+	assert.NoError(t, coll.CreateIndex("n"))
+	for i := 0; i < 50; i++ {
+		doc, _ := MarshalDocument(map[string]any{"id": fmt.Sprintf("%02d", i), "n": 0})
+		assert.NoError(t, coll.Put(*doc))
+	}
+
+	// Every write bumps all documents to the same n, one at a time. A
+	// snapshot taken in between sees at most two different values.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 1; n <= 20; n++ {
+			for i := 0; i < 50; i++ {
+				doc, _ := MarshalDocument(map[string]any{"id": fmt.Sprintf("%02d", i), "n": n})
+				assert.NoError(t, coll.Put(*doc))
+			}
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				sn := coll.Snapshot()
+				docs, err := sn.Query("n", QueryParams{})
+				assert.NoError(t, err)
+				assert.Len(t, docs, 50)
+				assert.Equal(t, docs, sortedByN(sn.List()))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// sortedByN orders documents the way the "n" index does.
+func sortedByN(docs []Document) []Document {
+	sortDocuments(docs, []SortField{{Field: "n"}})
+	return docs
+}
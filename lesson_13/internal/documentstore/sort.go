@@ -0,0 +1,156 @@
+package documentstore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/btree"
+)
+
+// SortField orders documents by the value at a dotted path, using the
+// cross-type value ordering. Documents missing the field sort as null.
+type SortField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+func validateSort(fields []SortField) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: no sort fields", ErrInvalidQuery)
+	}
+	for _, f := range fields {
+		if !validPath(f.Field) {
+			return fmt.Errorf("%w: invalid sort path %q", ErrInvalidQuery, f.Field)
+		}
+	}
+	return nil
+}
+
+func sortValue(doc Document, path string) any {
+	if f, ok := doc.Lookup(path); ok {
+		return normalizeValue(f.Value)
+	}
+	return nil
+}
+
+func sortKey(doc Document, fields []SortField) []any {
+	key := make([]any, len(fields))
+	for i, f := range fields {
+		key[i] = sortValue(doc, f.Field)
+	}
+	return key
+}
+
+func compareSortKeys(a, b []any, fields []SortField) int {
+	for i, f := range fields {
+		c := compareValues(a[i], b[i])
+		if f.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// sortDocuments sorts docs in place, keeping the order of equal documents.
+func sortDocuments(docs []Document, fields []SortField) {
+	type keyed struct {
+		key []any
+		doc Document
+	}
+	items := make([]keyed, len(docs))
+	for i, doc := range docs {
+		items[i] = keyed{key: sortKey(doc, fields), doc: doc}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return compareSortKeys(items[i].key, items[j].key, fields) < 0
+	})
+	for i, item := range items {
+		docs[i] = item.doc
+	}
+}
+
+// sortItem is a document in a sorted result, ordered by its sort key and
+// then by primary key so the order is total and can be resumed from.
+type sortItem struct {
+	keys []any
+	pk   string
+	doc  Document
+}
+
+// sortedPage returns a page of the documents read by each, ordered by
+// params.Sort. each calls fn with every candidate document. With
+// a limit only the first Skip+Limit+1 candidates are kept while reading,
+// in a B-tree that drops its largest item when it grows past that size, so
+// the candidates are never sorted as a whole. index identifies the read in
+// cursors; it is empty for List.
+func (sn *Snapshot) sortedPage(index string, params QueryParams, each func(fn func(pk string, doc Document)) error) (Page, error) {
+	if err := validateSort(params.Sort); err != nil {
+		return Page{}, err
+	}
+	if params.Desc {
+		return Page{}, fmt.Errorf("%w: sorted reads take the direction of each sort field", ErrInvalidQuery)
+	}
+
+	less := func(a, b *sortItem) bool {
+		if c := compareSortKeys(a.keys, b.keys, params.Sort); c != 0 {
+			return c < 0
+		}
+		return strings.Compare(a.pk, b.pk) < 0
+	}
+	var after *sortItem
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		if !c.Sorted || c.Index != index || len(c.Keys) != len(params.Sort) {
+			return Page{}, fmt.Errorf("%w: not a cursor of this sort", ErrInvalidCursor)
+		}
+		after = &sortItem{keys: c.Keys, pk: c.PK}
+		for i, v := range after.keys {
+			after.keys[i] = normalizeValue(v)
+		}
+	}
+
+	keep := 0
+	if params.Limit > 0 {
+		keep = params.Skip + params.Limit + 1
+	}
+	tree := btree.NewG(2, less)
+	err := each(func(pk string, doc Document) {
+		item := &sortItem{keys: sortKey(doc, params.Sort), pk: pk, doc: doc}
+		if after != nil && !less(after, item) {
+			return
+		}
+		tree.ReplaceOrInsert(item)
+		if keep > 0 && tree.Len() > keep {
+			tree.DeleteMax()
+		}
+	})
+	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Documents: []Document{}}
+	var last *sortItem
+	skip := params.Skip
+	tree.Ascend(func(item *sortItem) bool {
+		if skip > 0 {
+			skip--
+			return true
+		}
+		if params.Limit > 0 && len(page.Documents) == params.Limit {
+			// There is at least one more document.
+			page.Cursor = cursor{Index: index, Sorted: true, Keys: last.keys, PK: last.pk}.encode()
+			return false
+		}
+		page.Documents = append(page.Documents, params.Projection.apply(item.doc, sn.cfg.PrimaryKey))
+		last = item
+		return true
+	})
+	return page, nil
+}
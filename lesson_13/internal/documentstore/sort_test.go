@@ -0,0 +1,89 @@
+package documentstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListPage_Sort(t *testing.T) {
+	coll := setupOrdersCollection(t)
+
+	tests := []struct {
+		name string
+		sort []SortField
+		want []string
+	}{
+		{name: "mixed types", sort: []SortField{{Field: "total"}}, want: []string{"3", "1", "2", "5", "4"}},
+		{name: "mixed directions", sort: []SortField{{Field: "customer"}, {Field: "total", Desc: true}}, want: []string{"1", "3", "5", "2", "4"}},
+		{name: "arrays", sort: []SortField{{Field: "items"}}, want: []string{"3", "2", "4", "5", "1"}},
+		{name: "objects, missing last when descending", sort: []SortField{{Field: "shipping", Desc: true}}, want: []string{"2", "3", "1", "5", "4"}},
+		{name: "nested path, ties by primary key", sort: []SortField{{Field: "shipping.city"}}, want: []string{"4", "1", "5", "2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := coll.ListPage(QueryParams{Sort: tt.sort})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, pageIDs(page.Documents))
+			assert.Empty(t, page.Cursor)
+		})
+	}
+}
+
+func TestListPage_SortLimit(t *testing.T) {
+	coll := setupOrdersCollection(t)
+	byTotal := []SortField{{Field: "total"}}
+
+	page, err := coll.ListPage(QueryParams{Sort: byTotal, Skip: 1, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, pageIDs(page.Documents))
+	assert.NotEmpty(t, page.Cursor)
+
+	pages := collectPages(t, func(cursor string) (Page, error) {
+		return coll.ListPage(QueryParams{Sort: []SortField{{Field: "customer"}, {Field: "total", Desc: true}}, Limit: 2, Cursor: cursor})
+	})
+	assert.Equal(t, [][]string{{"1", "3"}, {"5", "2"}, {"4"}}, pages)
+
+	// The cursor resumes after the last document even if it changed.
+	page, err = coll.ListPage(QueryParams{Sort: byTotal, Limit: 2})
+	assert.NoError(t, err)
+	doc, _ := MarshalDocument(map[string]any{"id": "6", "total": 1})
+	assert.NoError(t, coll.Put(*doc))
+	next, err := coll.ListPage(QueryParams{Sort: byTotal, Limit: 2, Cursor: page.Cursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "5"}, pageIDs(next.Documents))
+
+	_, err = coll.ListPage(QueryParams{Cursor: page.Cursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = coll.ListPage(QueryParams{Sort: []SortField{{Field: "customer"}, {Field: "total"}}, Cursor: page.Cursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = coll.ListPage(QueryParams{Sort: byTotal, Desc: true})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = coll.ListPage(QueryParams{Sort: []SortField{{Field: ""}}})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestQueryPage_Sort(t *testing.T) {
+	coll := setupOrdersCollection(t)
+	assert.NoError(t, coll.CreateIndex("customer"))
+
+	pages := collectPages(t, func(cursor string) (Page, error) {
+		return coll.QueryPage("customer", QueryParams{MinValue: "bob", Sort: []SortField{{Field: "total", Desc: true}}, Limit: 2, Cursor: cursor})
+	})
+	assert.Equal(t, [][]string{{"4", "5"}, {"2"}}, pages)
+
+	page, err := coll.ListPage(QueryParams{Sort: []SortField{{Field: "total"}}, Limit: 1})
+	assert.NoError(t, err)
+	_, err = coll.QueryPage("customer", QueryParams{Sort: []SortField{{Field: "total"}}, Cursor: page.Cursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	page, err = coll.QueryPage("customer", QueryParams{Sort: []SortField{{Field: "customer"}}, Limit: 1})
+	assert.NoError(t, err)
+	_, err = coll.QueryPage("customer", QueryParams{Cursor: page.Cursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestCollection_ListOrder(t *testing.T) {
+	coll := setupOrdersCollection(t)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, pageIDs(coll.List()))
+}
@@ -1,15 +1,23 @@
 package documentstore
 
 import (
-	"encoding/json"
+	"bytes"
 	"errors"
-	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 )
 
 type Store struct {
-	collections map[string]*Collection
+	collections  map[string]*Collection
+	journal      *journal
+	checkpointer *checkpointer
+	checkpointMu sync.Mutex
+	mu           sync.RWMutex
+	feed         atomic.Pointer[changeFeed] // created by the first Watch
 }
 
 var (
@@ -27,19 +35,35 @@ func NewStore() *Store {
 }
 
 func (s *Store) CreateCollection(name string, cfg *CollectionConfig) (*Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if _, ok := s.collections[name]; ok {
 		l.Error("collection creation error: collection already exists", slog.Any("name", name))
 		return nil, ErrCollectionAlreadyExists
 	}
-	s.collections[name] = &Collection{
-		cfg:       *cfg,
-		documents: make(map[string]Document),
+	if err := s.log(&journalRecord{Op: opCreateCollection, Collection: name, Config: cfg}); err != nil {
+		l.Error("collection creation error: journal write failed", slog.Any("name", name), slog.String("error", err.Error()))
+		return nil, err
 	}
+	s.collections[name] = s.newCollection(name, *cfg)
 	l.Info("collection created", slog.Any("name", name))
 	return s.collections[name], nil
 }
 
+func (s *Store) newCollection(name string, cfg CollectionConfig) *Collection {
+	return &Collection{
+		name:      name,
+		store:     s,
+		cfg:       cfg,
+		documents: make(map[string]Document),
+	}
+}
+
 func (s *Store) GetCollection(name string) (*Collection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if collection, ok := s.collections[name]; ok {
 		return collection, nil
 	} else {
@@ -48,103 +72,117 @@ func (s *Store) GetCollection(name string) (*Collection, error) {
 }
 
 func (s *Store) DeleteCollection(name string) error {
-	if _, ok := s.collections[name]; !ok {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, ok := s.collections[name]
+	if !ok {
 		l.Error("collection deletion error: collection not found", slog.Any("name", name))
 		return ErrCollectionNotFound
 	}
+	// A caller may still hold the collection; its writes must not end up in
+	// the journal of a store it no longer belongs to, least of all after
+	// the deletion record, where replay could not apply them. Holding the
+	// collection lock from the record to the detach rules that out.
+	collection.mu.Lock()
+	defer collection.mu.Unlock()
+
+	if err := s.log(&journalRecord{Op: opDeleteCollection, Collection: name}); err != nil {
+		l.Error("collection deletion error: journal write failed", slog.Any("name", name), slog.String("error", err.Error()))
+		return err
+	}
 	delete(s.collections, name)
+	collection.store = nil
 	return nil
 }
 
+// log appends rec to the journal of a persistent store. In-memory stores
+// have no journal and log is a no-op.
+func (s *Store) log(rec *journalRecord) error {
+	if s.journal == nil {
+		return nil
+	}
+	return s.journal.append(rec)
+}
+
 func (s *Store) Dump() ([]byte, error) {
 
 	l.Info("hello dumping store", slog.Attr{
 		Key:   "qwe",
 		Value: slog.AnyValue(56),
 	})
-	dump := map[string]any{
-		"collections": make(map[string]any),
-	}
 
-	for name, collection := range s.collections {
-		var indexNames []string
-		if collection.indexes != nil {
-			for idxName := range collection.indexes {
-				indexNames = append(indexNames, idxName)
-			}
-		}
-		collectionDump := map[string]any{
-			"config":    collection.cfg,
-			"documents": collection.documents,
-			"indexes":   indexNames,
-		}
-		dump["collections"].(map[string]any)[name] = collectionDump
-	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	unlock := s.rlockCollections()
+	defer unlock()
 
-	jsonDump, err := json.Marshal(dump)
-	if err == nil {
-		return jsonDump, nil
+	var buf bytes.Buffer
+	if err := s.dumpTo(&buf); err != nil {
+		return nil, err
 	}
-
-	return nil, fmt.Errorf(ErrDumpStore.Error()+": %w", err)
+	return buf.Bytes(), nil
 }
 
-func NewStoreFromDump(dump []byte) (*Store, error) {
-	var data struct {
-		Collections map[string]struct {
-			Config    CollectionConfig    `json:"config"`
-			Documents map[string]Document `json:"documents"`
-			Indexes   []string            `json:"indexes"`
-		} `json:"collections"`
-	}
-
-	err := json.Unmarshal(dump, &data)
-	if err != nil {
-		return nil, fmt.Errorf(ErrDumpStore.Error()+": %w", err)
-	}
-
-	store := &Store{
-		collections: make(map[string]*Collection),
-	}
-
-	for name, data := range data.Collections {
-		collection := &Collection{
-			cfg:       data.Config,
-			documents: data.Documents,
-		}
-		for _, idxName := range data.Indexes {
-			_ = collection.CreateIndex(idxName)
+// rlockCollections read-locks every collection in name order, so that
+// concurrent callers never deadlock, and returns a function releasing them.
+// The caller must hold the store lock.
+func (s *Store) rlockCollections() func() {
+	names := make([]string, 0, len(s.collections))
+	for name := range s.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.collections[name].mu.RLock()
+	}
+	return func() {
+		for _, name := range names {
+			s.collections[name].mu.RUnlock()
 		}
-		store.collections[name] = collection
 	}
+}
 
-	return store, nil
+func NewStoreFromDump(dump []byte) (*Store, error) {
+	return NewStoreFromReader(bytes.NewReader(dump))
 }
 
+// DumpToFile atomically replaces filename with a checksummed dump of the
+// store. The file it replaces is kept as filename.prev for
+// NewStoreFromFileWithFallback.
 func (s *Store) DumpToFile(filename string) error {
-	data, err := s.Dump()
-	if err != nil {
-		return err
-	}
+	return writeDumpFile(filename, true, s.DumpTo)
+}
 
-	err = os.WriteFile(filename, data, 0644)
+// NewStoreFromFile restores a store written by DumpToFile. A file that fails
+// verification is rejected with ErrDumpCorrupt.
+func NewStoreFromFile(filename string) (*Store, error) {
+	var store *Store
+	err := readDumpFile(filename, func(r io.Reader) error {
+		var err error
+		store, err = NewStoreFromReader(r)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf(ErrDumpStoreFile.Error()+": %w", err)
+		return nil, err
 	}
 
-	return nil
+	return store, nil
 }
 
-func NewStoreFromFile(filename string) (*Store, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf(ErrReadFile.Error()+": %w", err)
+// NewStoreFromFileWithFallback behaves like NewStoreFromFile, but when
+// filename is missing or corrupt it restores the previous generation kept by
+// DumpToFile instead.
+func NewStoreFromFileWithFallback(filename string) (*Store, error) {
+	store, err := NewStoreFromFile(filename)
+	if err == nil || !(errors.Is(err, ErrDumpCorrupt) || errors.Is(err, os.ErrNotExist)) {
+		return store, err
 	}
 
-	store, err := NewStoreFromDump(data)
-	if err != nil {
+	prev, prevErr := NewStoreFromFile(filename + prevFileSuffix)
+	if prevErr != nil {
 		return nil, err
 	}
-
-	return store, nil
+	l.Warn("dump file unusable, restored previous generation", slog.String("file", filename), slog.String("error", err.Error()))
+	return prev, nil
 }
@@ -4,7 +4,10 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestNewStore(t *testing.T) {
@@ -55,6 +58,7 @@ func TestStore_CreateCollection(t *testing.T) {
 				},
 			},
 			want: &Collection{
+				name: "test",
 				cfg: CollectionConfig{
 					PrimaryKey: "id",
 				},
@@ -94,6 +98,9 @@ func TestStore_CreateCollection(t *testing.T) {
 				t.Errorf("CreateCollection() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if tt.want != nil {
+				tt.want.store = s
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("CreateCollection() got = %v, want %v", got, tt.want)
 			}
@@ -362,3 +369,136 @@ func TestStore_DumpToFile_Errors(t *testing.T) {
 		})
 	}
 }
+
+func TestStore_DumpToFile_Atomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "store.dump")
+
+	first := sampleStore(t)
+	assert.NoError(t, first.DumpToFile(filename))
+	second := NewStore()
+	_, _ = second.CreateCollection("other", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, second.DumpToFile(filename))
+
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"store.dump", "store.dump.prev"}, names)
+
+	data, _ := os.ReadFile(filename)
+	assert.True(t, strings.HasPrefix(string(data), dumpFileMagic+" "))
+
+	restored, err := NewStoreFromFile(filename)
+	assert.NoError(t, err)
+	_, err = restored.GetCollection("other")
+	assert.NoError(t, err)
+	previous, err := NewStoreFromFile(filename + prevFileSuffix)
+	assert.NoError(t, err)
+	_, err = previous.GetCollection("users")
+	assert.NoError(t, err)
+}
+
+func TestNewStoreFromFile_Corrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{
+			name: "flipped byte",
+			corrupt: func(data []byte) []byte {
+				data[len(data)/2] ^= 0x01
+				return data
+			},
+		},
+		{
+			name: "truncated body",
+			corrupt: func(data []byte) []byte {
+				return data[:len(data)-1]
+			},
+		},
+		{
+			name: "truncated header",
+			corrupt: func(data []byte) []byte {
+				return data[:dumpHeaderSize-3]
+			},
+		},
+		{
+			name: "trailing garbage",
+			corrupt: func(data []byte) []byte {
+				return append(data, '}')
+			},
+		},
+		{
+			name: "damaged header",
+			corrupt: func(data []byte) []byte {
+				copy(data[len(dumpFileMagic)+1:], "zz")
+				return data
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "store.dump")
+			assert.NoError(t, sampleStore(t).DumpToFile(filename))
+			assert.NoError(t, NewStore().DumpToFile(filename))
+
+			data, _ := os.ReadFile(filename)
+			assert.NoError(t, os.WriteFile(filename, tt.corrupt(data), 0644))
+
+			_, err := NewStoreFromFile(filename)
+			assert.ErrorIs(t, err, ErrDumpCorrupt)
+
+			restored, err := NewStoreFromFileWithFallback(filename)
+			assert.NoError(t, err)
+			_, err = restored.GetCollection("users")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNewStoreFromFileWithFallback(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "store.dump")
+
+	_, err := NewStoreFromFileWithFallback(filename)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Dumping again keeps the previous generation, which is restored when
+	// the current one is damaged.
+	assert.NoError(t, sampleStore(t).DumpToFile(filename))
+	_, err = os.Stat(filename + prevFileSuffix)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NoError(t, NewStore().DumpToFile(filename))
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filename, data[:len(data)-2], 0644))
+	restored, err := NewStoreFromFileWithFallback(filename)
+	assert.NoError(t, err)
+	_, err = restored.GetCollection("users")
+	assert.NoError(t, err)
+
+	// Without a usable previous generation the original error is returned.
+	assert.NoError(t, os.WriteFile(filename, []byte("{"), 0644))
+	assert.NoError(t, os.WriteFile(filename+prevFileSuffix, []byte("{"), 0644))
+	_, err = NewStoreFromFileWithFallback(filename)
+	assert.ErrorIs(t, err, ErrDumpCorrupt)
+}
+
+func TestNewStoreFromFile_Legacy(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "legacy.dump")
+	dump, err := sampleStore(t).Dump()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filename, dump, 0644))
+
+	restored, err := NewStoreFromFile(filename)
+	assert.NoError(t, err)
+	restoredDump, err := restored.Dump()
+	assert.NoError(t, err)
+	assert.Equal(t, string(dump), string(restoredDump))
+
+	assert.NoError(t, os.WriteFile(filename, dump[:len(dump)-2], 0644))
+	_, err = NewStoreFromFile(filename)
+	assert.ErrorIs(t, err, ErrDumpCorrupt)
+}
@@ -0,0 +1,284 @@
+package documentstore
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Tokenizer splits text into the terms stored in and looked up from a text
+// index. Documents and search queries go through the same tokenizer.
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+// TokenizerFunc adapts a function to the Tokenizer interface.
+type TokenizerFunc func(text string) []string
+
+func (f TokenizerFunc) Tokenize(text string) []string {
+	return f(text)
+}
+
+// BasicTokenizer splits text on everything but letters and digits,
+// lowercases the words, drops stop words and stems what is left.
+type BasicTokenizer struct {
+	StopWords map[string]bool
+	Stem      func(word string) string // nil leaves words as they are
+}
+
+func (t BasicTokenizer) Tokenize(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := words[:0]
+	for _, w := range words {
+		w = strings.ToLower(w)
+		if t.StopWords[w] {
+			continue
+		}
+		if t.Stem != nil {
+			w = t.Stem(w)
+		}
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// EnglishStopWords are the words the standard tokenizer ignores.
+var EnglishStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "from": true, "has": true,
+	"have": true, "in": true, "into": true, "is": true, "it": true, "its": true,
+	"no": true, "not": true, "of": true, "on": true, "or": true, "so": true,
+	"that": true, "the": true, "their": true, "then": true, "there": true,
+	"these": true, "they": true, "this": true, "to": true, "was": true,
+	"were": true, "will": true, "with": true,
+}
+
+// SimpleStem strips common English inflections: plurals, "-ing", "-ed" and
+// "-ly". It is deliberately naive; words keep at least three letters.
+func SimpleStem(word string) string {
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "xes") || strings.HasSuffix(word, "ches") || strings.HasSuffix(word, "shes"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ss") || strings.HasSuffix(word, "us") || strings.HasSuffix(word, "is"):
+		return word
+	}
+	for _, suffix := range []string{"ing", "ed", "ly", "s"} {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= 3 {
+			return word[:len(word)-len(suffix)]
+		}
+	}
+	return word
+}
+
+const (
+	StandardTokenizer = "standard" // BasicTokenizer with EnglishStopWords and SimpleStem
+	SimpleTokenizer   = "simple"   // BasicTokenizer that only lowercases
+)
+
+var (
+	tokenizersMu sync.RWMutex
+	tokenizers   = map[string]Tokenizer{
+		StandardTokenizer: BasicTokenizer{StopWords: EnglishStopWords, Stem: SimpleStem},
+		SimpleTokenizer:   BasicTokenizer{},
+	}
+)
+
+// RegisterTokenizer makes a tokenizer available to text indexes under the
+// given name. Text index configs refer to tokenizers by name so they can be
+// journaled and dumped; a store using a custom tokenizer must register it
+// before it is opened or restored.
+func RegisterTokenizer(name string, t Tokenizer) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	tokenizers[name] = t
+}
+
+func lookupTokenizer(name string) (Tokenizer, bool) {
+	tokenizersMu.RLock()
+	defer tokenizersMu.RUnlock()
+	t, ok := tokenizers[name]
+	return t, ok
+}
+
+// TextIndexConfig describes a full-text index over one or more string
+// fields. Arrays of strings are indexed element by element.
+type TextIndexConfig struct {
+	Name      string   `json:"name,omitempty"`      // defaults to "text:" followed by the fields joined by commas
+	Fields    []string `json:"fields"`              // dotted paths, see Document.Lookup
+	Tokenizer string   `json:"tokenizer,omitempty"` // registered tokenizer, StandardTokenizer by default
+}
+
+func (c TextIndexConfig) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return "text:" + strings.Join(c.Fields, ",")
+}
+
+func (c TextIndexConfig) tokenizer() string {
+	if c.Tokenizer != "" {
+		return c.Tokenizer
+	}
+	return StandardTokenizer
+}
+
+func (c TextIndexConfig) validate() error {
+	if len(c.Fields) == 0 {
+		return fmt.Errorf("%w: no fields", ErrInvalidIndex)
+	}
+	for _, f := range c.Fields {
+		if f == "" || !validPath(f) {
+			return fmt.Errorf("%w: invalid field path %q", ErrInvalidIndex, f)
+		}
+	}
+	if _, ok := lookupTokenizer(c.tokenizer()); !ok {
+		return fmt.Errorf("%w: unknown tokenizer %q", ErrInvalidIndex, c.tokenizer())
+	}
+	return nil
+}
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// textIndex is an inverted index from terms to the documents containing
+// them, with the term frequencies and document lengths BM25 needs.
+type textIndex struct {
+	cfg       TextIndexConfig
+	tokenizer Tokenizer
+	postings  map[string]map[string]int // term -> primary key -> term frequency
+	docTerms  map[string][]string       // primary key -> distinct terms
+	lengths   map[string]int            // primary key -> number of terms
+	total     int                       // sum of lengths
+}
+
+func newTextIndex(cfg TextIndexConfig) *textIndex {
+	t, _ := lookupTokenizer(cfg.tokenizer())
+	return &textIndex{
+		cfg:       cfg,
+		tokenizer: t,
+		postings:  make(map[string]map[string]int),
+		docTerms:  make(map[string][]string),
+		lengths:   make(map[string]int),
+	}
+}
+
+// terms tokenizes the indexed fields of doc.
+func (idx *textIndex) terms(doc Document) []string {
+	var terms []string
+	for _, path := range idx.cfg.Fields {
+		field, ok := doc.Lookup(path)
+		if !ok {
+			continue
+		}
+		switch field.Type {
+		case DocumentFieldTypeString:
+			if s, ok := normalizeValue(field.Value).(string); ok {
+				terms = append(terms, idx.tokenizer.Tokenize(s)...)
+			}
+		case DocumentFieldTypeArray:
+			rv := reflect.ValueOf(field.Value)
+			if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+				continue
+			}
+			for i := 0; i < rv.Len(); i++ {
+				if s, ok := normalizeValue(rv.Index(i).Interface()).(string); ok {
+					terms = append(terms, idx.tokenizer.Tokenize(s)...)
+				}
+			}
+		}
+	}
+	return terms
+}
+
+func (idx *textIndex) insert(pk string, doc Document) {
+	terms := idx.terms(doc)
+	if len(terms) == 0 {
+		return
+	}
+	var distinct []string
+	for _, term := range terms {
+		docs, ok := idx.postings[term]
+		if !ok {
+			docs = make(map[string]int)
+			idx.postings[term] = docs
+		}
+		if docs[pk] == 0 {
+			distinct = append(distinct, term)
+		}
+		docs[pk]++
+	}
+	idx.docTerms[pk] = distinct
+	idx.lengths[pk] = len(terms)
+	idx.total += len(terms)
+}
+
+func (idx *textIndex) remove(pk string) {
+	for _, term := range idx.docTerms[pk] {
+		docs := idx.postings[term]
+		delete(docs, pk)
+		if len(docs) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.total -= idx.lengths[pk]
+	delete(idx.docTerms, pk)
+	delete(idx.lengths, pk)
+}
+
+// SearchResult is a document matched by Collection.Search with its score.
+type SearchResult struct {
+	Document Document
+	Score    float64
+}
+
+// search scores the documents containing any of the query terms with BM25
+// and returns their primary keys with the scores, best first.
+func (idx *textIndex) search(query string) ([]string, map[string]float64) {
+	n := float64(len(idx.lengths))
+	if n == 0 {
+		return nil, nil
+	}
+	avgLen := float64(idx.total) / n
+
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, term := range idx.tokenizer.Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		docs := idx.postings[term]
+		df := float64(len(docs))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for pk, tf := range docs {
+			f := float64(tf)
+			norm := 1 - bm25B + bm25B*float64(idx.lengths[pk])/avgLen
+			scores[pk] += idf * f * (bm25K1 + 1) / (f + bm25K1*norm)
+		}
+	}
+
+	pks := make([]string, 0, len(scores))
+	for pk := range scores {
+		pks = append(pks, pk)
+	}
+	sort.Slice(pks, func(i, j int) bool {
+		if scores[pks[i]] != scores[pks[j]] {
+			return scores[pks[i]] > scores[pks[j]]
+		}
+		return pks[i] < pks[j]
+	})
+	return pks, scores
+}
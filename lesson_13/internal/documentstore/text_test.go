@@ -0,0 +1,157 @@
+package documentstore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasicTokenizer(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenizer string
+		text      string
+		want      []string
+	}{
+		{name: "standard", tokenizer: StandardTokenizer, text: "The Cats are RUNNING, quickly!", want: []string{"cat", "runn", "quick"}},
+		{name: "standard plurals", tokenizer: StandardTokenizer, text: "classes stories bus indexes", want: []string{"class", "story", "bus", "index"}},
+		{name: "standard digits", tokenizer: StandardTokenizer, text: "go1.23 release", want: []string{"go1", "23", "release"}},
+		{name: "simple", tokenizer: SimpleTokenizer, text: "The Cats", want: []string{"the", "cats"}},
+		{name: "empty", tokenizer: StandardTokenizer, text: " ,. ", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, ok := lookupTokenizer(tt.tokenizer)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, tok.Tokenize(tt.text))
+		})
+	}
+}
+
+func setupNotesCollection(t *testing.T) *Collection {
+	coll := &Collection{
+		cfg:       CollectionConfig{PrimaryKey: "id"},
+		documents: map[string]Document{},
+	}
+	for _, n := range []map[string]any{
+		{"id": "1", "title": "Go channels", "body": "Channels connect goroutines. A channel is typed."},
+		{"id": "2", "title": "Databases", "body": "Indexes make queries fast."},
+		{"id": "3", "title": "Go maps", "body": "Maps are not safe for concurrent use.", "tags": []any{"go", "concurrency"}},
+		{"id": "4", "title": 42},
+	} {
+		doc, _ := MarshalDocument(n)
+		assert.NoError(t, coll.Put(*doc))
+	}
+	assert.NoError(t, coll.CreateTextIndex(TextIndexConfig{Fields: []string{"title", "body", "tags"}}))
+	return coll
+}
+
+func searchIDs(t *testing.T, coll *Collection, index, query string, limit int) []string {
+	results, err := coll.Search(index, query, limit)
+	assert.NoError(t, err)
+	ids := []string{}
+	for i, r := range results {
+		ids = append(ids, r.Document.Fields["id"].Value.(string))
+		if i > 0 {
+			assert.GreaterOrEqual(t, results[i-1].Score, r.Score)
+		}
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	coll := setupNotesCollection(t)
+	const index = "text:title,body,tags"
+
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []string
+	}{
+		{name: "stemmed term", query: "channel", want: []string{"1"}},
+		{name: "rarer term ranks higher", query: "go concurrent", want: []string{"3", "1"}},
+		{name: "term frequency", query: "go", want: []string{"3", "1"}},
+		{name: "limit", query: "go", limit: 1, want: []string{"3"}},
+		{name: "any term, shorter document first", query: "index goroutine", want: []string{"2", "1"}},
+		{name: "stop words only", query: "the is a", want: []string{}},
+		{name: "no match", query: "python", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, searchIDs(t, coll, index, tt.query, tt.limit))
+		})
+	}
+
+	_, err := coll.Search("title", "go", 0)
+	assert.ErrorIs(t, err, ErrIndexNotFound)
+}
+
+func TestSearch_Maintenance(t *testing.T) {
+	coll := setupNotesCollection(t)
+	const index = "text:title,body,tags"
+
+	doc, _ := MarshalDocument(map[string]any{"id": "1", "title": "Python lists"})
+	assert.NoError(t, coll.Put(*doc))
+	assert.Equal(t, []string{}, searchIDs(t, coll, index, "channel", 0))
+	assert.Equal(t, []string{"1"}, searchIDs(t, coll, index, "list", 0))
+
+	assert.NoError(t, coll.Delete("3"))
+	assert.Equal(t, []string{}, searchIDs(t, coll, index, "maps", 0))
+
+	idx := coll.textIndexes[index]
+	assert.Equal(t, 2, len(idx.lengths))
+	assert.Equal(t, 2, len(idx.docTerms))
+	for term, docs := range idx.postings {
+		assert.NotContains(t, docs, "3", term)
+	}
+
+	assert.NoError(t, coll.DeleteIndex(index))
+	_, err := coll.Search(index, "list", 0)
+	assert.ErrorIs(t, err, ErrIndexNotFound)
+}
+
+func TestCreateTextIndex(t *testing.T) {
+	coll := setupNotesCollection(t)
+	RegisterTokenizer("test-upper", TokenizerFunc(func(text string) []string {
+		return strings.Fields(strings.ToUpper(text))
+	}))
+
+	assert.ErrorIs(t, coll.CreateTextIndex(TextIndexConfig{}), ErrInvalidIndex)
+	assert.ErrorIs(t, coll.CreateTextIndex(TextIndexConfig{Fields: []string{"a..b"}}), ErrInvalidIndex)
+	assert.ErrorIs(t, coll.CreateTextIndex(TextIndexConfig{Fields: []string{"body"}, Tokenizer: "missing"}), ErrInvalidIndex)
+	assert.ErrorIs(t, coll.CreateTextIndex(TextIndexConfig{Fields: []string{"title", "body", "tags"}}), ErrIndexExists)
+	assert.NoError(t, coll.CreateIndex("title"))
+	assert.ErrorIs(t, coll.CreateTextIndex(TextIndexConfig{Name: "title", Fields: []string{"title"}}), ErrIndexExists)
+
+	assert.NoError(t, coll.CreateTextIndex(TextIndexConfig{Name: "upper", Fields: []string{"title"}, Tokenizer: "test-upper"}))
+	assert.Equal(t, []string{"3"}, searchIDs(t, coll, "upper", "maps", 0))
+}
+
+func TestTextIndex_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	store, users := openUsers(t, dir, nil)
+	assert.NoError(t, users.Put(userDoc("1", "Alice Liddell")))
+	assert.NoError(t, users.CreateTextIndex(TextIndexConfig{Name: "names", Fields: []string{"name"}, Tokenizer: SimpleTokenizer}))
+	assert.NoError(t, users.Put(userDoc("2", "Alice Cooper")))
+
+	dump, err := store.Dump()
+	assert.NoError(t, err)
+	assert.Contains(t, string(dump), `"indexes":null,"text_indexes":[{"name":"names","fields":["name"],"tokenizer":"simple"}]`)
+	fromDump, err := NewStoreFromDump(dump)
+	assert.NoError(t, err)
+	col, _ := fromDump.GetCollection("users")
+	assert.Equal(t, []string{"1", "2"}, searchIDs(t, col, "names", "alice", 0))
+
+	assert.NoError(t, store.Close())
+	replayed, col := openUsers(t, dir, nil)
+	assert.Equal(t, []string{"2"}, searchIDs(t, col, "names", "cooper", 0))
+	assert.NoError(t, col.DeleteIndex("names"))
+	assert.NoError(t, replayed.Close())
+
+	replayed, col = openUsers(t, dir, nil)
+	defer replayed.Close()
+	_, err = col.Search("names", "alice", 0)
+	assert.ErrorIs(t, err, ErrIndexNotFound)
+}
@@ -0,0 +1,211 @@
+package documentstore
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+var ErrTxDone = errors.New("transaction already committed or rolled back")
+
+// Tx is a set of puts and deletes across the collections of a store that
+// Commit applies atomically. The writes are only buffered until then:
+// readers of the collections do not see them before Commit, and then see
+// all of them at once. Get reads through the buffered writes.
+type Tx struct {
+	store  *Store
+	writes []txWrite
+	done   bool
+	mu     sync.Mutex
+}
+
+// txWrite is a buffered put, or a delete when doc is nil.
+type txWrite struct {
+	collection string
+	key        string
+	doc        *Document
+}
+
+// Begin starts a transaction on the store.
+func (s *Store) Begin() *Tx {
+	return &Tx{store: s}
+}
+
+// Put buffers storing doc in the named collection. The primary key is
+// checked right away; unique indexes are checked by Commit.
+func (tx *Tx) Put(collection string, doc Document) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	c, err := tx.store.GetCollection(collection)
+	if err != nil {
+		return err
+	}
+	pk, err := c.primaryKey(doc)
+	if err != nil {
+		return err
+	}
+	tx.writes = append(tx.writes, txWrite{collection: collection, key: pk, doc: &doc})
+	return nil
+}
+
+// Delete buffers deleting the document stored under key in the named
+// collection. Commit fails with ErrDocumentNotFound if there is no such
+// document by then.
+func (tx *Tx) Delete(collection string, key string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	if _, err := tx.store.GetCollection(collection); err != nil {
+		return err
+	}
+	tx.writes = append(tx.writes, txWrite{collection: collection, key: key})
+	return nil
+}
+
+// Get returns the document stored under key in the named collection as the
+// transaction sees it: with its own writes applied.
+func (tx *Tx) Get(collection string, key string) (*Document, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	for i := len(tx.writes) - 1; i >= 0; i-- {
+		w := tx.writes[i]
+		if w.collection != collection || w.key != key {
+			continue
+		}
+		if w.doc == nil {
+			return nil, ErrDocumentNotFound
+		}
+		doc := *w.doc
+		return &doc, nil
+	}
+	c, err := tx.store.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(key)
+}
+
+// Rollback discards the buffered writes. It is a no-op on a transaction
+// that is already done.
+func (tx *Tx) Rollback() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.done = true
+	tx.writes = nil
+}
+
+// Commit applies the buffered writes in order, all of them or none. The
+// collections written to are locked in name order, the same order every
+// multi-collection operation of the store uses, so concurrent commits
+// cannot deadlock. The writes are journaled as a single record. On error
+// nothing is applied and the transaction is done either way.
+func (tx *Tx) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	if len(tx.writes) == 0 {
+		return nil
+	}
+
+	s := tx.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var names []string
+	collections := make(map[string]*Collection)
+	for _, w := range tx.writes {
+		if _, ok := collections[w.collection]; ok {
+			continue
+		}
+		c, ok := s.collections[w.collection]
+		if !ok {
+			l.Error("transaction error: collection not found", slog.Any("name", w.collection))
+			return fmt.Errorf("%w: %s", ErrCollectionNotFound, w.collection)
+		}
+		collections[w.collection] = c
+		names = append(names, w.collection)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		collections[name].mu.Lock()
+	}
+	defer func() {
+		for _, name := range names {
+			collections[name].mu.Unlock()
+		}
+	}()
+
+	// Apply the writes one by one so each is checked against the ones
+	// before it, remembering what they replaced to undo them on failure.
+	// No reader can see the intermediate states while the locks are held.
+	undo := make([]txWrite, 0, len(tx.writes))
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			u := undo[i]
+			if u.doc == nil {
+				collections[u.collection].applyDelete(u.key)
+			} else {
+				collections[u.collection].applyPut(u.key, *u.doc)
+			}
+		}
+	}
+	records := make([]journalRecord, 0, len(tx.writes))
+	events := make([]ChangeEvent, 0, len(tx.writes))
+	for _, w := range tx.writes {
+		c := collections[w.collection]
+		prev := txWrite{collection: w.collection, key: w.key}
+		if doc, ok := c.documents[w.key]; ok {
+			prev.doc = &doc
+		}
+
+		if w.doc == nil {
+			if prev.doc == nil {
+				rollback()
+				l.Error("transaction error: document not found", slog.Any("collection", w.collection), slog.Any("PrimaryKey", w.key))
+				return fmt.Errorf("%w: %s in %s", ErrDocumentNotFound, w.key, w.collection)
+			}
+			c.applyDelete(w.key)
+			records = append(records, journalRecord{Op: opDelete, Collection: w.collection, Key: w.key})
+			events = append(events, c.change(w.key, prev.doc, nil))
+		} else {
+			if err := c.checkUnique(w.key, *w.doc); err != nil {
+				rollback()
+				l.Error("transaction error: unique index violated", slog.Any("collection", w.collection), slog.Any("PrimaryKey", w.key), slog.String("error", err.Error()))
+				return err
+			}
+			doc := *w.doc
+			doc.Revision = c.nextRevision()
+			c.applyPut(w.key, doc)
+			records = append(records, journalRecord{Op: opPut, Collection: w.collection, Document: &doc})
+			events = append(events, c.change(w.key, prev.doc, &doc))
+		}
+		undo = append(undo, prev)
+	}
+
+	if err := s.log(&journalRecord{Op: opTransaction, Ops: records}); err != nil {
+		rollback()
+		l.Error("transaction error: journal write failed", slog.String("error", err.Error()))
+		return err
+	}
+	s.publish(events)
+	l.Info("transaction committed", slog.Int("writes", len(tx.writes)))
+	return nil
+}
@@ -0,0 +1,196 @@
+package documentstore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupAccounts(t *testing.T, store *Store) (*Collection, *Collection) {
+	active, err := store.CreateCollection("active", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, err)
+	archived, err := store.CreateCollection("archived", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, err)
+	assert.NoError(t, active.Put(userDoc("1", "Alice")))
+	assert.NoError(t, active.Put(userDoc("2", "Bob")))
+	return active, archived
+}
+
+func TestTx_Commit(t *testing.T) {
+	store := NewStore()
+	active, archived := setupAccounts(t, store)
+
+	tx := store.Begin()
+	assert.NoError(t, tx.Put("archived", userDoc("1", "Alice")))
+	assert.NoError(t, tx.Delete("active", "1"))
+	assert.NoError(t, tx.Put("active", userDoc("2", "Bobby")))
+
+	// The transaction reads its own writes, nobody else does yet.
+	_, err := tx.Get("active", "1")
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+	doc, err := tx.Get("archived", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", doc.Fields["name"].Value)
+	_, err = archived.Get("1")
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+	doc, _ = active.Get("2")
+	assert.Equal(t, "Bob", doc.Fields["name"].Value)
+
+	assert.NoError(t, tx.Commit())
+	assert.Equal(t, []string{"2"}, pageIDs(active.List()))
+	assert.Equal(t, []string{"1"}, pageIDs(archived.List()))
+	doc, _ = active.Get("2")
+	assert.Equal(t, "Bobby", doc.Fields["name"].Value)
+
+	assert.ErrorIs(t, tx.Commit(), ErrTxDone)
+	assert.ErrorIs(t, tx.Put("active", userDoc("3", "Carol")), ErrTxDone)
+}
+
+func TestTx_Rollback(t *testing.T) {
+	store := NewStore()
+	active, _ := setupAccounts(t, store)
+
+	tx := store.Begin()
+	assert.NoError(t, tx.Delete("active", "1"))
+	tx.Rollback()
+	assert.ErrorIs(t, tx.Commit(), ErrTxDone)
+	assert.ErrorIs(t, tx.Delete("active", "2"), ErrTxDone)
+	assert.Len(t, active.List(), 2)
+}
+
+func TestTx_Errors(t *testing.T) {
+	store := NewStore()
+	active, archived := setupAccounts(t, store)
+	assert.NoError(t, active.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "name"}}, Unique: true}))
+
+	tx := store.Begin()
+	assert.ErrorIs(t, tx.Put("missing", userDoc("1", "x")), ErrCollectionNotFound)
+	assert.ErrorIs(t, tx.Put("active", Document{Fields: map[string]DocumentField{}}), ErrDocumentNoPrimaryKey)
+
+	tests := []struct {
+		name    string
+		writes  func(tx *Tx)
+		wantErr error
+	}{
+		{
+			name: "unique index violated by a later write",
+			writes: func(tx *Tx) {
+				assert.NoError(t, tx.Put("archived", userDoc("9", "Zed")))
+				assert.NoError(t, tx.Put("active", userDoc("1", "Carol")))
+				assert.NoError(t, tx.Put("active", userDoc("3", "Carol")))
+			},
+			wantErr: ErrDuplicateKey,
+		},
+		{
+			name: "deleting a missing document",
+			writes: func(tx *Tx) {
+				assert.NoError(t, tx.Delete("active", "2"))
+				assert.NoError(t, tx.Delete("active", "2"))
+			},
+			wantErr: ErrDocumentNotFound,
+		},
+		{
+			name: "collection deleted before commit",
+			writes: func(tx *Tx) {
+				assert.NoError(t, tx.Delete("active", "1"))
+				_, _ = store.CreateCollection("tmp", &CollectionConfig{PrimaryKey: "id"})
+				assert.NoError(t, tx.Put("tmp", userDoc("1", "x")))
+				assert.NoError(t, store.DeleteCollection("tmp"))
+			},
+			wantErr: ErrCollectionNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := store.Begin()
+			tt.writes(tx)
+			assert.ErrorIs(t, tx.Commit(), tt.wantErr)
+
+			// Nothing was applied, indexes included.
+			assert.Equal(t, []string{"1", "2"}, pageIDs(active.List()))
+			assert.Empty(t, archived.List())
+			docs, err := active.Query("name", QueryParams{})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"1", "2"}, pageIDs(docs))
+			doc, _ := active.Get("1")
+			assert.Equal(t, "Alice", doc.Fields["name"].Value)
+		})
+	}
+}
+
+func TestTx_Concurrent(t *testing.T) {
+	store := NewStore()
+	a, _ := store.CreateCollection("a", &CollectionConfig{PrimaryKey: "id"})
+	b, _ := store.CreateCollection("b", &CollectionConfig{PrimaryKey: "id"})
+
+	// Writers touching the collections in opposite orders must not
+	// deadlock, and readers never see half of a transaction.
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				name := fmt.Sprintf("w%d-%d", w, i)
+				tx := store.Begin()
+				if w%2 == 0 {
+					assert.NoError(t, tx.Put("a", userDoc("x", name)))
+					assert.NoError(t, tx.Put("b", userDoc("x", name)))
+					assert.NoError(t, tx.Put("a", userDoc("y", name)))
+				} else {
+					assert.NoError(t, tx.Put("b", userDoc("x", name)))
+					assert.NoError(t, tx.Put("a", userDoc("y", name)))
+					assert.NoError(t, tx.Put("a", userDoc("x", name)))
+				}
+				assert.NoError(t, tx.Commit())
+			}
+		}(w)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			docs := a.List()
+			if len(docs) == 2 {
+				assert.Equal(t, docs[0].Fields["name"], docs[1].Fields["name"])
+			}
+		}
+	}()
+	wg.Wait()
+
+	x, _ := a.Get("x")
+	y, _ := a.Get("y")
+	bx, _ := b.Get("x")
+	assert.Equal(t, x.Fields["name"], y.Fields["name"])
+	assert.Equal(t, x.Fields["name"], bx.Fields["name"])
+}
+
+func TestTx_Journal(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	setupAccounts(t, store)
+	tx := store.Begin()
+	assert.NoError(t, tx.Put("archived", userDoc("1", "Alice")))
+	assert.NoError(t, tx.Delete("active", "1"))
+	assert.NoError(t, tx.Commit())
+	failed := store.Begin()
+	assert.NoError(t, failed.Put("archived", userDoc("2", "Bob")))
+	assert.NoError(t, failed.Delete("active", "1"))
+	assert.ErrorIs(t, failed.Commit(), ErrDocumentNotFound)
+	assert.NoError(t, store.Close())
+
+	restored, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer restored.Close()
+	active, _ := restored.GetCollection("active")
+	archived, _ := restored.GetCollection("archived")
+	assert.Equal(t, []string{"2"}, pageIDs(active.List()))
+	assert.Equal(t, []string{"1"}, pageIDs(archived.List()))
+}
@@ -0,0 +1,238 @@
+package documentstore
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+)
+
+var ErrInvalidUpdate = errors.New("invalid update")
+
+type UpdateOp string
+
+const (
+	UpdateSet    UpdateOp = "set"
+	UpdateUnset  UpdateOp = "unset"
+	UpdateInc    UpdateOp = "inc"
+	UpdateMul    UpdateOp = "mul"
+	UpdatePush   UpdateOp = "push"
+	UpdatePull   UpdateOp = "pull"
+	UpdateRename UpdateOp = "rename"
+	UpdateMin    UpdateOp = "min"
+	UpdateMax    UpdateOp = "max"
+)
+
+// Update is an operator changing the field at a dotted path of a document.
+// Set stores Value, creating the objects along the path; unset removes the
+// field. Inc adds the number Value to the field and mul multiplies it by
+// Value; a missing field counts as 0. Push appends Values to an array,
+// creating it if missing, and pull removes the elements equal to any of
+// Values. Rename moves the field to the path To. Min and max set the field
+// to Value if it is missing or Value compares lower or higher, in the
+// index ordering. Operators on a missing field that have nothing to do
+// leave the document unchanged. Updates are plain data so they can be sent
+// as JSON.
+type Update struct {
+	Op     UpdateOp `json:"op"`
+	Field  string   `json:"field"`
+	Value  any      `json:"value,omitempty"`
+	Values []any    `json:"values,omitempty"`
+	To     string   `json:"to,omitempty"`
+}
+
+func Set(field string, value any) Update { return Update{Op: UpdateSet, Field: field, Value: value} }
+func Unset(field string) Update          { return Update{Op: UpdateUnset, Field: field} }
+func Inc(field string, by any) Update    { return Update{Op: UpdateInc, Field: field, Value: by} }
+func Mul(field string, by any) Update    { return Update{Op: UpdateMul, Field: field, Value: by} }
+func Min(field string, value any) Update { return Update{Op: UpdateMin, Field: field, Value: value} }
+func Max(field string, value any) Update { return Update{Op: UpdateMax, Field: field, Value: value} }
+
+func Push(field string, values ...any) Update {
+	return Update{Op: UpdatePush, Field: field, Values: values}
+}
+
+func Pull(field string, values ...any) Update {
+	return Update{Op: UpdatePull, Field: field, Values: values}
+}
+
+func Rename(field, to string) Update { return Update{Op: UpdateRename, Field: field, To: to} }
+
+func (u Update) validate() error {
+	if u.Field == "" || !validPath(u.Field) {
+		return fmt.Errorf("%w: invalid field path %q", ErrInvalidUpdate, u.Field)
+	}
+	switch u.Op {
+	case UpdateSet, UpdateMin, UpdateMax:
+		if _, ok := fieldOf(u.Value); !ok {
+			return fmt.Errorf("%w: %s takes a value", ErrInvalidUpdate, u.Op)
+		}
+	case UpdateInc, UpdateMul:
+		if _, ok := normalizeValue(u.Value).(float64); !ok {
+			return fmt.Errorf("%w: %s takes a number", ErrInvalidUpdate, u.Op)
+		}
+	case UpdatePush, UpdatePull:
+		if len(u.Values) == 0 {
+			return fmt.Errorf("%w: %s without values", ErrInvalidUpdate, u.Op)
+		}
+	case UpdateRename:
+		if u.To == "" || !validPath(u.To) || u.To == u.Field {
+			return fmt.Errorf("%w: invalid rename target %q", ErrInvalidUpdate, u.To)
+		}
+	case UpdateUnset:
+	default:
+		return fmt.Errorf("%w: unknown update operator %q", ErrInvalidUpdate, u.Op)
+	}
+	return nil
+}
+
+// apply returns a copy of doc changed by the update, which must be valid.
+func (u Update) apply(doc Document) (Document, error) {
+	field, found := doc.Lookup(u.Field)
+
+	switch u.Op {
+	case UpdateSet:
+		f, _ := fieldOf(u.Value)
+		return doc.withField(u.Field, f), nil
+	case UpdateUnset:
+		doc, _ = doc.withoutField(u.Field)
+		return doc, nil
+	case UpdateInc, UpdateMul:
+		by := normalizeValue(u.Value).(float64)
+		var n float64
+		if found {
+			v, ok := normalizeValue(field.Value).(float64)
+			if !ok {
+				return Document{}, fmt.Errorf("%w: field %q is not a number", ErrInvalidUpdate, u.Field)
+			}
+			n = v
+		}
+		if u.Op == UpdateInc {
+			n += by
+		} else {
+			n *= by
+		}
+		return doc.withField(u.Field, DocumentField{Type: DocumentFieldTypeNumber, Value: n}), nil
+	case UpdatePush, UpdatePull:
+		var elems []any
+		if found {
+			var ok bool
+			if elems, ok = arrayElems(field); !ok {
+				return Document{}, fmt.Errorf("%w: field %q is not an array", ErrInvalidUpdate, u.Field)
+			}
+		} else if u.Op == UpdatePull {
+			return doc, nil
+		}
+		if u.Op == UpdatePush {
+			elems = append(elems, u.Values...)
+		} else {
+			kept := []any{}
+			for _, e := range elems {
+				if !containsValue(u.Values, e) {
+					kept = append(kept, e)
+				}
+			}
+			elems = kept
+		}
+		return doc.withField(u.Field, DocumentField{Type: DocumentFieldTypeArray, Value: elems}), nil
+	case UpdateRename:
+		if !found {
+			return doc, nil
+		}
+		doc, _ = doc.withoutField(u.Field)
+		return doc.withField(u.To, field), nil
+	case UpdateMin, UpdateMax:
+		c := 0
+		if found {
+			c = compareValues(normalizeValue(u.Value), normalizeValue(field.Value))
+		}
+		if !found || u.Op == UpdateMin && c < 0 || u.Op == UpdateMax && c > 0 {
+			f, _ := fieldOf(u.Value)
+			return doc.withField(u.Field, f), nil
+		}
+		return doc, nil
+	}
+	return doc, nil
+}
+
+// arrayElems returns a copy of the elements of an array field.
+func arrayElems(field DocumentField) ([]any, bool) {
+	if field.Type != DocumentFieldTypeArray {
+		return nil, false
+	}
+	rv := reflect.ValueOf(field.Value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	elems := make([]any, rv.Len())
+	for i := range elems {
+		elems[i] = rv.Index(i).Interface()
+	}
+	return elems, true
+}
+
+func containsValue(values []any, v any) bool {
+	for _, w := range values {
+		if equalValues(v, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// Update applies the updates in order to the document stored under key and
+// returns the result. The document is read, changed and stored under the
+// write lock, so concurrent updates do not lose each other's changes. The
+// primary key cannot be changed. Either all the updates apply or, on error,
+// none.
+func (s *Collection) Update(key string, updates ...Update) (*Document, error) {
+	for _, u := range updates {
+		if err := u.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.documents[key]
+	if !ok {
+		l.Error("document update error: document not found", slog.Any("PrimaryKey", key))
+		return nil, ErrDocumentNotFound
+	}
+	doc, err := s.updated(key, prev, updates)
+	if err != nil {
+		l.Error("document update error", slog.Any("PrimaryKey", key), slog.String("error", err.Error()))
+		return nil, err
+	}
+	if err := s.checkUnique(key, doc); err != nil {
+		l.Error("document update error: unique index violated", slog.Any("PrimaryKey", key), slog.String("error", err.Error()))
+		return nil, err
+	}
+	doc.Revision = s.nextRevision()
+	if err := s.log(&journalRecord{Op: opPut, Document: &doc}); err != nil {
+		l.Error("document update error: journal write failed", slog.Any("PrimaryKey", key), slog.String("error", err.Error()))
+		return nil, err
+	}
+	s.applyPut(key, doc)
+	s.publish([]ChangeEvent{s.change(key, &prev, &doc)})
+
+	l.Info("document updated", slog.Any("PrimaryKey", key))
+	return &doc, nil
+}
+
+// updated returns doc, stored under key, changed by the updates. The
+// document is journaled whole, so replaying it does not run the updates
+// again.
+func (s *Collection) updated(key string, doc Document, updates []Update) (Document, error) {
+	var err error
+	for _, u := range updates {
+		if doc, err = u.apply(doc); err != nil {
+			return Document{}, err
+		}
+	}
+	if pk, err := s.primaryKey(doc); err != nil || pk != key {
+		return Document{}, fmt.Errorf("%w: the primary key cannot be changed", ErrInvalidUpdate)
+	}
+	return doc, nil
+}
@@ -0,0 +1,152 @@
+package documentstore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func accountDoc() Document {
+	return Document{Fields: map[string]DocumentField{
+		"id":      {Type: DocumentFieldTypeString, Value: "1"},
+		"name":    {Type: DocumentFieldTypeString, Value: "Alice"},
+		"balance": {Type: DocumentFieldTypeNumber, Value: 10.0},
+		"tags":    {Type: DocumentFieldTypeArray, Value: []any{"a", "b", "a"}},
+		"home": {Type: DocumentFieldTypeObject, Value: Document{Fields: map[string]DocumentField{
+			"city": {Type: DocumentFieldTypeString, Value: "Kyiv"},
+		}}},
+	}}
+}
+
+func TestCollection_Update(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates []Update
+		path    string
+		want    any
+		wantOk  bool
+		wantErr error
+	}{
+		{name: "set", updates: []Update{Set("name", "Alicia")}, path: "name", want: "Alicia", wantOk: true},
+		{name: "set nested", updates: []Update{Set("home.zip", 1000)}, path: "home.zip", want: 1000, wantOk: true},
+		{name: "set keeps siblings", updates: []Update{Set("home.zip", 1000)}, path: "home.city", want: "Kyiv", wantOk: true},
+		{name: "unset", updates: []Update{Unset("name")}, path: "name"},
+		{name: "unset nested", updates: []Update{Unset("home.city")}, path: "home.city"},
+		{name: "unset missing", updates: []Update{Unset("home.street")}, path: "home.city", want: "Kyiv", wantOk: true},
+		{name: "inc", updates: []Update{Inc("balance", 5)}, path: "balance", want: 15.0, wantOk: true},
+		{name: "inc missing", updates: []Update{Inc("visits", 1)}, path: "visits", want: 1.0, wantOk: true},
+		{name: "mul", updates: []Update{Mul("balance", 1.5)}, path: "balance", want: 15.0, wantOk: true},
+		{name: "mul missing", updates: []Update{Mul("visits", 3)}, path: "visits", want: 0.0, wantOk: true},
+		{name: "push", updates: []Update{Push("tags", "c", "d")}, path: "tags", want: []any{"a", "b", "a", "c", "d"}, wantOk: true},
+		{name: "push missing", updates: []Update{Push("home.phones", "123")}, path: "home.phones", want: []any{"123"}, wantOk: true},
+		{name: "pull", updates: []Update{Pull("tags", "a", "x")}, path: "tags", want: []any{"b"}, wantOk: true},
+		{name: "pull missing", updates: []Update{Pull("phones", "x")}, path: "phones"},
+		{name: "rename", updates: []Update{Rename("name", "profile.name")}, path: "profile.name", want: "Alice", wantOk: true},
+		{name: "rename removes the old field", updates: []Update{Rename("name", "nick")}, path: "name"},
+		{name: "min lower", updates: []Update{Min("balance", 3)}, path: "balance", want: 3, wantOk: true},
+		{name: "min higher", updates: []Update{Min("balance", 30)}, path: "balance", want: 10.0, wantOk: true},
+		{name: "max higher", updates: []Update{Max("balance", 30)}, path: "balance", want: 30, wantOk: true},
+		{name: "max missing", updates: []Update{Max("score", 2)}, path: "score", want: 2, wantOk: true},
+		{name: "applied in order", updates: []Update{Set("n", 2), Mul("n", 3), Inc("n", 1)}, path: "n", want: 7.0, wantOk: true},
+		{name: "inc not a number", updates: []Update{Set("n", 2), Inc("name", 1)}, wantErr: ErrInvalidUpdate},
+		{name: "push not an array", updates: []Update{Push("name", "x")}, wantErr: ErrInvalidUpdate},
+		{name: "unset primary key", updates: []Update{Unset("id")}, wantErr: ErrInvalidUpdate},
+		{name: "set primary key", updates: []Update{Set("id", "2")}, wantErr: ErrInvalidUpdate},
+		{name: "unknown operator", updates: []Update{{Op: "swap", Field: "name"}}, wantErr: ErrInvalidUpdate},
+		{name: "inc by a string", updates: []Update{Inc("balance", "1")}, wantErr: ErrInvalidUpdate},
+		{name: "empty path", updates: []Update{Set("", 1)}, wantErr: ErrInvalidUpdate},
+		{name: "rename onto itself", updates: []Update{Rename("name", "name")}, wantErr: ErrInvalidUpdate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+			assert.NoError(t, c.Put(accountDoc()))
+
+			got, err := c.Update("1", tt.updates...)
+			stored, _ := c.Get("1")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				// Nothing is applied on error.
+				assert.Equal(t, uint64(1), stored.Revision)
+				assert.Equal(t, accountDoc().Fields, stored.Fields)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, stored, got)
+			assert.Equal(t, uint64(2), got.Revision)
+			field, ok := got.Lookup(tt.path)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, field.Value)
+		})
+	}
+}
+
+func TestCollection_UpdateMaintainsIndexes(t *testing.T) {
+	c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+	assert.NoError(t, c.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "name"}}, Unique: true}))
+	assert.NoError(t, c.Put(userDoc("1", "Alice")))
+	assert.NoError(t, c.Put(userDoc("2", "Bob")))
+
+	_, err := c.Update("1", Set("name", "Alicia"))
+	assert.NoError(t, err)
+	docs, err := c.Query("name", QueryParams{MinValue: "Alicia", MaxValue: "Alicia"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, pageIDs(docs))
+	docs, _ = c.Query("name", QueryParams{MinValue: "Alice", MaxValue: "Alice"})
+	assert.Empty(t, docs)
+
+	_, err = c.Update("2", Set("name", "Alicia"))
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+	_, err = c.Update("3", Set("name", "Carol"))
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+}
+
+func TestCollection_UpdateConcurrent(t *testing.T) {
+	c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+	assert.NoError(t, c.Put(userDoc("1", "Alice")))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := c.Update("1", Inc("count", 1), Push("log", fmt.Sprintf("%d-%d", i, j)))
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	doc, _ := c.Get("1")
+	assert.Equal(t, 200.0, doc.Fields["count"].Value)
+	assert.Len(t, doc.Fields["log"].Value, 200)
+	assert.Equal(t, uint64(201), doc.Revision)
+}
+
+func TestStore_UpdateReplays(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, users.Put(userDoc("1", "Alice")))
+	_, err = users.Update("1", Inc("visits", 2), Rename("name", "nick"))
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+
+	restored, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer restored.Close()
+	users, _ = restored.GetCollection("users")
+	doc, err := users.Get("1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, doc.Fields["visits"].Value)
+	assert.Equal(t, "Alice", doc.Fields["nick"].Value)
+	assert.Equal(t, uint64(2), doc.Revision)
+}
@@ -0,0 +1,170 @@
+package documentstore
+
+import (
+	"cmp"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Values of different types are ordered by type first:
+//
+//	null < number < string < object < array < bool
+//
+// and then within the type: numerically with NaN before the other numbers,
+// lexicographically by bytes, and false before true. Arrays compare element by element, a shorter array
+// first when it is a prefix of the other. Objects compare their fields in
+// name order, by name and then by value, a subset of leading fields first.
+const (
+	rankNull = iota
+	rankNumber
+	rankString
+	rankObject
+	rankArray
+	rankBool
+)
+
+// normalizeValue converts a field value to the representation used for
+// comparisons: every Go number kind becomes float64, named string and bool
+// types become string and bool, and pointers are dereferenced. Other values
+// are returned unchanged.
+func normalizeValue(v any) any {
+	switch v := v.(type) {
+	case nil, string, float64, bool:
+		return v
+	case int:
+		return float64(v)
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	}
+	return rv.Interface()
+}
+
+// typeRank returns the position of the type of a normalized value in the
+// cross-type ordering.
+func typeRank(v any) int {
+	switch v.(type) {
+	case nil:
+		return rankNull
+	case float64:
+		return rankNumber
+	case string:
+		return rankString
+	case bool:
+		return rankBool
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Slice, reflect.Array:
+		return rankArray
+	}
+	return rankObject
+}
+
+// compareValues orders two normalized values, returning -1, 0 or 1.
+func compareValues(a, b any) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+
+	switch a := a.(type) {
+	case float64:
+		// cmp.Compare gives NaN a place in the order; with < and > it
+		// would equal every number and leave indexes inconsistent.
+		return cmp.Compare(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		b := b.(bool)
+		switch {
+		case a == b:
+			return 0
+		case !a:
+			return -1
+		}
+		return 1
+	}
+
+	switch ra {
+	case rankArray:
+		va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+		for i := 0; i < va.Len() && i < vb.Len(); i++ {
+			if c := compareValues(normalizeValue(va.Index(i).Interface()), normalizeValue(vb.Index(i).Interface())); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(va.Len(), vb.Len())
+	case rankObject:
+		fa, fb := objectValues(a), objectValues(b)
+		na, nb := sortedNames(fa), sortedNames(fb)
+		for i := 0; i < len(na) && i < len(nb); i++ {
+			if c := strings.Compare(na[i], nb[i]); c != 0 {
+				return c
+			}
+			if c := compareValues(normalizeValue(fa[na[i]]), normalizeValue(fb[nb[i]])); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(len(na), len(nb))
+	}
+	return 0
+}
+
+// objectValues returns the values of the fields of an object: a Document,
+// an encoded Document, a map with string keys or a struct.
+func objectValues(v any) map[string]any {
+	doc, _ := asDocument(v)
+	values := make(map[string]any, len(doc.Fields))
+	for name, f := range doc.Fields {
+		values[name] = f.Value
+	}
+	return values
+}
+
+func sortedNames(values map[string]any) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scalarKey returns the normalized value of a string, number or bool field.
+// Fields whose value does not match their declared type are rejected.
+func scalarKey(field DocumentField) (any, bool) {
+	key := normalizeValue(field.Value)
+	switch field.Type {
+	case DocumentFieldTypeString:
+		_, ok := key.(string)
+		return key, ok
+	case DocumentFieldTypeNumber:
+		_, ok := key.(float64)
+		return key, ok
+	case DocumentFieldTypeBool:
+		_, ok := key.(bool)
+		return key, ok
+	}
+	return nil, false
+}
@@ -0,0 +1,68 @@
+package documentstore
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareValues(t *testing.T) {
+	type myString string
+	tests := []struct {
+		name string
+		a, b any
+		want int
+	}{
+		{name: "numbers", a: 2, b: 10.5, want: -1},
+		{name: "mixed number kinds", a: int64(3), b: float32(3), want: 0},
+		{name: "NaN before numbers", a: math.NaN(), b: math.Inf(-1), want: -1},
+		{name: "NaN equals NaN", a: math.NaN(), b: float32(math.NaN()), want: 0},
+		{name: "null before NaN", a: nil, b: math.NaN(), want: -1},
+		{name: "strings", a: "b", b: "a", want: 1},
+		{name: "named string", a: myString("a"), b: "a", want: 0},
+		{name: "bools", a: false, b: true, want: -1},
+		{name: "null before numbers", a: nil, b: -1, want: -1},
+		{name: "numbers before strings", a: 100, b: "1", want: -1},
+		{name: "strings before objects", a: "z", b: map[string]any{}, want: -1},
+		{name: "objects before arrays", a: map[string]any{}, b: []any{}, want: -1},
+		{name: "arrays before bools", a: []any{}, b: false, want: -1},
+		{name: "pointers", a: new(int), b: 0, want: 0},
+		{name: "arrays by element", a: []any{1, "b"}, b: []int{1, 2}, want: 1},
+		{name: "array prefix first", a: []any{1}, b: []any{1.0, nil}, want: -1},
+		{name: "longer array last", a: []any{"a", []any{true}}, b: []string{"a"}, want: 1},
+		{name: "objects by field name", a: map[string]any{"a": 2}, b: map[string]any{"b": 1}, want: -1},
+		{name: "objects by field value", a: map[string]any{"a": 2}, b: map[string]int{"a": 1}, want: 1},
+		{name: "object field subset first", a: map[string]any{"a": 1}, b: map[string]any{"a": 1, "b": 0}, want: -1},
+		{name: "document and map", a: Document{Fields: map[string]DocumentField{"a": {Type: DocumentFieldTypeNumber, Value: 1}}}, b: map[string]any{"a": 1.0}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, compareValues(normalizeValue(tt.a), normalizeValue(tt.b)))
+		})
+	}
+}
+
+func TestScalarKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		field  DocumentField
+		want   any
+		wantOk bool
+	}{
+		{name: "string", field: DocumentField{Type: DocumentFieldTypeString, Value: "x"}, want: "x", wantOk: true},
+		{name: "int number", field: DocumentField{Type: DocumentFieldTypeNumber, Value: 42}, want: 42.0, wantOk: true},
+		{name: "bool", field: DocumentField{Type: DocumentFieldTypeBool, Value: true}, want: true, wantOk: true},
+		{name: "type mismatch", field: DocumentField{Type: DocumentFieldTypeNumber, Value: "42"}, wantOk: false},
+		{name: "array", field: DocumentField{Type: DocumentFieldTypeArray, Value: []any{1}}, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := scalarKey(tt.field)
+			assert.Equal(t, tt.wantOk, ok)
+			if tt.wantOk {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package documentstore
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrInvalidResumeToken = errors.New("invalid resume token")
+
+type ChangeType string
+
+const (
+	ChangeInsert  ChangeType = "insert"
+	ChangeReplace ChangeType = "replace"
+	ChangeDelete  ChangeType = "delete"
+)
+
+// ChangeEvent describes a document written or deleted. Seq numbers the
+// events of a store, or of a collection outside a store, in the order the
+// changes were made. Token, passed back in WatchOptions.ResumeAfter,
+// resumes a stream after the event. Before is the document replaced or
+// deleted and After the document written.
+type ChangeEvent struct {
+	Seq        uint64     `json:"seq"`
+	Token      string     `json:"token"`
+	Type       ChangeType `json:"type"`
+	Collection string     `json:"collection"`
+	Key        string     `json:"key"`
+	Before     *Document  `json:"before,omitempty"`
+	After      *Document  `json:"after,omitempty"`
+}
+
+// OverflowPolicy says what happens to the events of a watcher that does not
+// keep up. Writers never wait for watchers.
+type OverflowPolicy string
+
+const (
+	OverflowDrop   OverflowPolicy = "drop"   // drop events beyond BufferSize, see Watcher.Dropped
+	OverflowBuffer OverflowPolicy = "buffer" // keep every event in memory until received
+)
+
+// WatchOptions configures a watcher. Filter, tested against After, or
+// Before for deletes, and Types select the events delivered; by default
+// all are. ResumeAfter, the token of an event, first delivers the events
+// after it, as long as the store still retains them: it keeps the last
+// changeHistory events, and tokens are only valid until the store is
+// closed, as sequence numbers start over when it is opened again.
+type WatchOptions struct {
+	Filter      *Filter        `json:"filter,omitempty"`
+	Types       []ChangeType   `json:"types,omitempty"`
+	ResumeAfter string         `json:"resume_after,omitempty"`
+	BufferSize  int            `json:"buffer_size,omitempty"` // events held for the watcher, defaults to 64
+	Overflow    OverflowPolicy `json:"overflow,omitempty"`    // defaults to OverflowDrop
+}
+
+// changeHistory is the number of events kept for watchers to resume from.
+const changeHistory = 1024
+
+func (o *WatchOptions) validate() error {
+	if o.Filter != nil {
+		if err := o.Filter.validate(); err != nil {
+			return err
+		}
+	}
+	for _, t := range o.Types {
+		switch t {
+		case ChangeInsert, ChangeReplace, ChangeDelete:
+		default:
+			return fmt.Errorf("%w: unknown change type %q", ErrInvalidQuery, t)
+		}
+	}
+	switch o.Overflow {
+	case "", OverflowDrop, OverflowBuffer:
+	default:
+		return fmt.Errorf("%w: unknown overflow policy %q", ErrInvalidQuery, o.Overflow)
+	}
+	if o.BufferSize < 0 {
+		return fmt.Errorf("%w: negative buffer size", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// Watcher delivers change events on C, in sequence order, until Close.
+type Watcher struct {
+	C <-chan ChangeEvent
+
+	feed       *changeFeed
+	collection string // only events of this collection unless empty
+	opts       WatchOptions
+
+	mu      sync.Mutex
+	queue   []ChangeEvent
+	wake    chan struct{}
+	done    chan struct{}
+	closed  bool
+	dropped atomic.Uint64
+}
+
+// Dropped returns the number of events dropped because the watcher did not
+// keep up, with OverflowDrop.
+func (w *Watcher) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Close stops the watcher and closes C. Events not received yet are lost.
+func (w *Watcher) Close() {
+	w.feed.unsubscribe(w)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.done)
+	}
+}
+
+func (w *Watcher) wants(ev ChangeEvent) bool {
+	if w.collection != "" && ev.Collection != w.collection {
+		return false
+	}
+	if len(w.opts.Types) > 0 && !slices.Contains(w.opts.Types, ev.Type) {
+		return false
+	}
+	if w.opts.Filter != nil {
+		doc := ev.After
+		if doc == nil {
+			doc = ev.Before
+		}
+		return w.opts.Filter.match(*doc)
+	}
+	return true
+}
+
+// push queues ev for delivery without blocking.
+func (w *Watcher) push(ev ChangeEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	if w.opts.Overflow != OverflowBuffer && len(w.queue) >= w.opts.BufferSize {
+		w.dropped.Add(1)
+		return
+	}
+	w.queue = append(w.queue, ev)
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pump hands the queued events to C one at a time.
+func (w *Watcher) pump(ch chan<- ChangeEvent) {
+	defer close(ch)
+	for {
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			select {
+			case <-w.wake:
+				continue
+			case <-w.done:
+				return
+			}
+		}
+		ev := w.queue[0]
+		w.mu.Unlock()
+
+		select {
+		case ch <- ev:
+		case <-w.done:
+			return
+		}
+
+		w.mu.Lock()
+		w.queue[0] = ChangeEvent{}
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+	}
+}
+
+// changeFeed numbers change events and hands them to the watchers. It
+// keeps the latest events for watchers resuming a stream. The random epoch
+// tells its tokens from those of other feeds, which number events alike.
+type changeFeed struct {
+	mu       sync.Mutex
+	epoch    uint64
+	seq      uint64
+	history  []ChangeEvent
+	watchers map[*Watcher]struct{}
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{epoch: rand.Uint64(), watchers: make(map[*Watcher]struct{})}
+}
+
+func (f *changeFeed) token(seq uint64) string {
+	return fmt.Sprintf("%016x%016x", f.epoch, seq)
+}
+
+// parseToken returns the sequence number of a token of the feed.
+func (f *changeFeed) parseToken(token string) (uint64, error) {
+	var epoch, seq uint64
+	if _, err := fmt.Sscanf(token, "%016x%016x", &epoch, &seq); err != nil || len(token) != 32 {
+		return 0, fmt.Errorf("%w: malformed token %q", ErrInvalidResumeToken, token)
+	}
+	if epoch != f.epoch {
+		return 0, fmt.Errorf("%w: token of another stream, or from before the store was reopened", ErrInvalidResumeToken)
+	}
+	return seq, nil
+}
+
+// publish numbers the events and delivers them. Writers call it holding
+// the locks of the collections written to, so the events of a collection
+// are numbered in the order of its writes.
+func (f *changeFeed) publish(events []ChangeEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ev := range events {
+		f.seq++
+		ev.Seq = f.seq
+		ev.Token = f.token(f.seq)
+		if len(f.history) == changeHistory {
+			f.history[0] = ChangeEvent{}
+			f.history = f.history[1:]
+		}
+		f.history = append(f.history, ev)
+		for w := range f.watchers {
+			if w.wants(ev) {
+				w.push(ev)
+			}
+		}
+	}
+}
+
+func (f *changeFeed) subscribe(collection string, opts WatchOptions) (*Watcher, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.BufferSize == 0 {
+		opts.BufferSize = 64
+	}
+
+	ch := make(chan ChangeEvent)
+	w := &Watcher{
+		C:          ch,
+		feed:       f,
+		collection: collection,
+		opts:       opts,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if opts.ResumeAfter != "" {
+		after, err := f.parseToken(opts.ResumeAfter)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case after > f.seq:
+			return nil, fmt.Errorf("%w: %d is ahead of the stream at %d", ErrInvalidResumeToken, after, f.seq)
+		case after < f.seq-uint64(len(f.history)):
+			return nil, fmt.Errorf("%w: events after %d are no longer retained", ErrInvalidResumeToken, after)
+		}
+		for _, ev := range f.history[len(f.history)-int(f.seq-after):] {
+			if w.wants(ev) {
+				w.push(ev)
+			}
+		}
+	}
+	f.watchers[w] = struct{}{}
+	go w.pump(ch)
+	return w, nil
+}
+
+func (f *changeFeed) unsubscribe(w *Watcher) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.watchers, w)
+}
+
+// Watch streams the changes to the documents of all collections of the
+// store. Dropping a collection does not produce events for its documents.
+func (s *Store) Watch(opts WatchOptions) (*Watcher, error) {
+	return s.changes().subscribe("", opts)
+}
+
+// changes returns the change feed of the store, creating it on first use.
+func (s *Store) changes() *changeFeed {
+	if f := s.feed.Load(); f != nil {
+		return f
+	}
+	s.feed.CompareAndSwap(nil, newChangeFeed())
+	return s.feed.Load()
+}
+
+// publish hands events to the watchers of the store, if any.
+func (s *Store) publish(events []ChangeEvent) {
+	if f := s.feed.Load(); f != nil && len(events) > 0 {
+		f.publish(events)
+	}
+}
+
+// Watch streams the changes to the documents of the collection. The events
+// of a collection in a store are numbered with those of the other
+// collections, see Store.Watch.
+func (s *Collection) Watch(opts WatchOptions) (*Watcher, error) {
+	s.mu.RLock()
+	store := s.store
+	s.mu.RUnlock()
+
+	if store != nil {
+		return store.changes().subscribe(s.name, opts)
+	}
+	if f := s.feed.Load(); f == nil {
+		s.feed.CompareAndSwap(nil, newChangeFeed())
+	}
+	return s.feed.Load().subscribe("", opts)
+}
+
+// publish hands events to the watchers of the collection, if any. The
+// caller must hold the write lock.
+func (s *Collection) publish(events []ChangeEvent) {
+	if s.store != nil {
+		s.store.publish(events)
+	} else if f := s.feed.Load(); f != nil && len(events) > 0 {
+		f.publish(events)
+	}
+}
+
+// change returns the event for the document stored under pk going from
+// before to after, nil meaning none.
+func (s *Collection) change(pk string, before, after *Document) ChangeEvent {
+	ev := ChangeEvent{Type: ChangeReplace, Collection: s.name, Key: pk, Before: before, After: after}
+	switch {
+	case before == nil:
+		ev.Type = ChangeInsert
+	case after == nil:
+		ev.Type = ChangeDelete
+	}
+	return ev
+}
@@ -0,0 +1,226 @@
+package documentstore
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receive returns the next n events of the watcher.
+func receive(t *testing.T, w *Watcher, n int) []ChangeEvent {
+	t.Helper()
+	events := make([]ChangeEvent, 0, n)
+	for len(events) < n {
+		select {
+		case ev, ok := <-w.C:
+			if !ok {
+				t.Fatalf("watcher closed after %d events", len(events))
+			}
+			events = append(events, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d events", len(events))
+		}
+	}
+	return events
+}
+
+func assertNoEvent(t *testing.T, w *Watcher) {
+	t.Helper()
+	select {
+	case ev := <-w.C:
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestCollection_Watch(t *testing.T) {
+	c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+	w, err := c.Watch(WatchOptions{})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	assert.NoError(t, c.Put(userDoc("1", "Alice")))
+	assert.NoError(t, c.Put(userDoc("1", "Alicia")))
+	_, err = c.Update("1", Set("age", 30))
+	assert.NoError(t, err)
+	assert.NoError(t, c.Delete("1"))
+	assert.ErrorIs(t, c.Delete("1"), ErrDocumentNotFound)
+
+	events := receive(t, w, 4)
+	assertNoEvent(t, w)
+	for i, ev := range events {
+		assert.Equal(t, uint64(i+1), ev.Seq)
+		assert.Equal(t, "1", ev.Key)
+	}
+	assert.Equal(t, []ChangeType{ChangeInsert, ChangeReplace, ChangeReplace, ChangeDelete},
+		[]ChangeType{events[0].Type, events[1].Type, events[2].Type, events[3].Type})
+
+	assert.Nil(t, events[0].Before)
+	assert.Equal(t, "Alice", events[0].After.Fields["name"].Value)
+	assert.Equal(t, "Alice", events[1].Before.Fields["name"].Value)
+	assert.Equal(t, "Alicia", events[1].After.Fields["name"].Value)
+	assert.Equal(t, uint64(2), events[1].After.Revision)
+	assert.Equal(t, 30, events[2].After.Fields["age"].Value)
+	assert.Equal(t, uint64(3), events[3].Before.Revision)
+	assert.Nil(t, events[3].After)
+
+	w.Close()
+	_, ok := <-w.C
+	assert.False(t, ok)
+}
+
+func TestStore_Watch(t *testing.T) {
+	store := NewStore()
+	active, archived := setupAccounts(t, store)
+
+	all, err := store.Watch(WatchOptions{})
+	assert.NoError(t, err)
+	defer all.Close()
+	onlyArchived, err := archived.Watch(WatchOptions{})
+	assert.NoError(t, err)
+	defer onlyArchived.Close()
+	bob := Eq("name", "Bob")
+	bobDeletes, err := store.Watch(WatchOptions{Types: []ChangeType{ChangeDelete}, Filter: &bob})
+	assert.NoError(t, err)
+	defer bobDeletes.Close()
+
+	tx := store.Begin()
+	assert.NoError(t, tx.Put("archived", userDoc("2", "Bob")))
+	assert.NoError(t, tx.Delete("active", "2"))
+	assert.NoError(t, tx.Commit())
+	_, err = active.PutMany([]Document{userDoc("3", "Carol"), userDoc("4", "Dave")}, BulkOptions{})
+	assert.NoError(t, err)
+	picked := In("id", "1", "3")
+	_, err = active.DeleteWhere(Selector{Filter: &picked})
+	assert.NoError(t, err)
+
+	events := receive(t, all, 6)
+	var got []string
+	for i, ev := range events {
+		assert.Equal(t, events[0].Seq+uint64(i), ev.Seq)
+		got = append(got, fmt.Sprintf("%s %s %s", ev.Type, ev.Collection, ev.Key))
+	}
+	assert.Equal(t, []string{
+		"insert archived 2",
+		"delete active 2",
+		"insert active 3",
+		"insert active 4",
+		"delete active 1",
+		"delete active 3",
+	}, got)
+
+	ev := receive(t, onlyArchived, 1)[0]
+	assert.Equal(t, "2", ev.Key)
+	assertNoEvent(t, onlyArchived)
+	ev = receive(t, bobDeletes, 1)[0]
+	assert.Equal(t, "active", ev.Collection)
+	assertNoEvent(t, bobDeletes)
+
+	// Failed writes produce no events.
+	_, err = active.Bulk([]BulkOp{{Delete: "4"}, {Delete: "missing"}}, BulkOptions{Atomic: true})
+	assert.Error(t, err)
+	assertNoEvent(t, all)
+}
+
+func TestStore_WatchResume(t *testing.T) {
+	store := NewStore()
+	users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	w, err := store.Watch(WatchOptions{})
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, users.Put(userDoc(fmt.Sprint(i), "x")))
+	}
+	last := receive(t, w, 2)[1].Token
+	w.Close()
+
+	// Changes made while nobody watches are replayed on resume.
+	assert.NoError(t, users.Delete("0"))
+	w, err = users.Watch(WatchOptions{ResumeAfter: last})
+	assert.NoError(t, err)
+	defer w.Close()
+	var keys []string
+	for _, ev := range receive(t, w, 4) {
+		keys = append(keys, string(ev.Type)+" "+ev.Key)
+	}
+	assert.Equal(t, []string{"insert 2", "insert 3", "insert 4", "delete 0"}, keys)
+
+	_, err = store.Watch(WatchOptions{ResumeAfter: store.changes().token(100)})
+	assert.ErrorIs(t, err, ErrInvalidResumeToken)
+	_, err = store.Watch(WatchOptions{ResumeAfter: "100"})
+	assert.ErrorIs(t, err, ErrInvalidResumeToken)
+	_, err = NewStore().Watch(WatchOptions{ResumeAfter: last})
+	assert.ErrorIs(t, err, ErrInvalidResumeToken)
+	for i := 0; i < changeHistory; i++ {
+		assert.NoError(t, users.Put(userDoc("0", fmt.Sprint(i))))
+	}
+	_, err = store.Watch(WatchOptions{ResumeAfter: last})
+	assert.ErrorIs(t, err, ErrInvalidResumeToken)
+
+	_, err = store.Watch(WatchOptions{Overflow: "block"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = store.Watch(WatchOptions{Types: []ChangeType{"update"}})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestWatcher_Overflow(t *testing.T) {
+	c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+	dropping, err := c.Watch(WatchOptions{BufferSize: 2})
+	assert.NoError(t, err)
+	defer dropping.Close()
+	buffering, err := c.Watch(WatchOptions{BufferSize: 2, Overflow: OverflowBuffer})
+	assert.NoError(t, err)
+	defer buffering.Close()
+
+	// Nobody reads while writing, and the writes do not wait.
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, c.Put(userDoc("1", fmt.Sprint(i))))
+	}
+
+	// The dropping watcher kept the first events.
+	events := receive(t, dropping, 2)
+	assert.Equal(t, "0", events[0].After.Fields["name"].Value)
+	assert.Equal(t, "1", events[1].After.Fields["name"].Value)
+	assert.Equal(t, uint64(98), dropping.Dropped())
+	assertNoEvent(t, dropping)
+
+	events = receive(t, buffering, 100)
+	for i, ev := range events {
+		assert.Equal(t, uint64(i+1), ev.Seq)
+	}
+	assert.Zero(t, buffering.Dropped())
+}
+
+func TestStore_WatchResumeAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	w, err := users.Watch(WatchOptions{})
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, users.Put(userDoc(fmt.Sprint(i), "x")))
+	}
+	token := receive(t, w, 3)[2].Token
+	w.Close()
+	assert.NoError(t, store.Close())
+
+	// The reopened store numbers its events from 1 again, so the token
+	// would resume in the middle of unrelated events.
+	restored, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer restored.Close()
+	users, _ = restored.GetCollection("users")
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, users.Put(userDoc(fmt.Sprint(i+10), "y")))
+	}
+	_, err = restored.Watch(WatchOptions{ResumeAfter: token})
+	assert.ErrorIs(t, err, ErrInvalidResumeToken)
+	_, err = users.Watch(WatchOptions{ResumeAfter: token})
+	assert.ErrorIs(t, err, ErrInvalidResumeToken)
+}
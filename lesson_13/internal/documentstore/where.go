@@ -0,0 +1,128 @@
+package documentstore
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Selector picks the documents DeleteWhere and UpdateWhere change: those
+// in the range Params of the index Index, those matching Filter, or those
+// in the range that also match Filter when both are set. Params take
+// effect as in QueryPage, so Skip, Limit and Sort can narrow the range
+// down, say to the ten oldest documents; Projection is ignored.
+type Selector struct {
+	Index  string      `json:"index,omitempty"`
+	Params QueryParams `json:"params,omitempty"`
+	Filter *Filter     `json:"filter,omitempty"`
+}
+
+func (sel Selector) validate() error {
+	if sel.Index == "" && sel.Filter == nil {
+		return fmt.Errorf("%w: a selector needs an index or a filter", ErrInvalidQuery)
+	}
+	if sel.Filter != nil {
+		if err := sel.Filter.validate(); err != nil {
+			return err
+		}
+	}
+	return validatePage(sel.Params)
+}
+
+// DeleteWhere deletes the documents picked by sel and returns how many
+// there were. The documents are picked and deleted under a single write
+// lock and journaled as a single record, so other writers and readers see
+// all of them gone at once.
+func (s *Collection) DeleteWhere(sel Selector) (int, error) {
+	if err := sel.validate(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pks, err := s.selected(sel)
+	if err != nil {
+		return 0, err
+	}
+	b := batch{c: s}
+	for _, pk := range pks {
+		b.delete(pk)
+	}
+	if err := b.commit(); err != nil {
+		l.Error("document deletion error: journal write failed", slog.String("error", err.Error()))
+		return 0, err
+	}
+	l.Info("documents deleted", slog.Int("count", len(pks)))
+	return len(pks), nil
+}
+
+// UpdateWhere applies the updates to every document picked by sel, see
+// Update, and returns how many there were. Like DeleteWhere it runs under a
+// single write lock; if the updates fail on any document, none of the
+// documents is changed.
+func (s *Collection) UpdateWhere(sel Selector, updates ...Update) (int, error) {
+	if err := sel.validate(); err != nil {
+		return 0, err
+	}
+	for _, u := range updates {
+		if err := u.validate(); err != nil {
+			return 0, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pks, err := s.selected(sel)
+	if err != nil {
+		return 0, err
+	}
+	b := batch{c: s}
+	for _, pk := range pks {
+		doc, err := s.updated(pk, s.documents[pk], updates)
+		if err == nil {
+			err = s.checkUnique(pk, doc)
+		}
+		if err != nil {
+			b.rollback()
+			l.Error("document update error", slog.Any("PrimaryKey", pk), slog.String("error", err.Error()))
+			return 0, err
+		}
+		b.put(pk, doc)
+	}
+	if err := b.commit(); err != nil {
+		l.Error("document update error: journal write failed", slog.String("error", err.Error()))
+		return 0, err
+	}
+	l.Info("documents updated", slog.Int("count", len(pks)))
+	return len(pks), nil
+}
+
+// selected returns the primary keys of the documents picked by sel, which
+// must be valid. The caller must hold the write lock.
+func (s *Collection) selected(sel Selector) ([]string, error) {
+	sn := s.snapshot()
+	var pks []string
+	if sel.Index == "" {
+		sn.find(*sel.Filter, nil, func(pk string, _ Document) bool {
+			pks = append(pks, pk)
+			return true
+		})
+		return pks, nil
+	}
+
+	params := sel.Params
+	params.Projection = nil
+	page, err := sn.queryPage(sel.Index, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range page.Documents {
+		if sel.Filter != nil && !sel.Filter.match(doc) {
+			continue
+		}
+		pk, _ := doc.Fields[s.cfg.PrimaryKey].Value.(string)
+		pks = append(pks, pk)
+	}
+	return pks, nil
+}
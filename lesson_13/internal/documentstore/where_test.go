@@ -0,0 +1,148 @@
+package documentstore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func scoredUsers(t *testing.T, c *Collection, n int) {
+	for i := 0; i < n; i++ {
+		doc := userDoc(fmt.Sprintf("%02d", i), fmt.Sprintf("user%d", i))
+		doc.Fields["score"] = DocumentField{Type: DocumentFieldTypeNumber, Value: float64(i)}
+		doc.Fields["even"] = DocumentField{Type: DocumentFieldTypeBool, Value: i%2 == 0}
+		assert.NoError(t, c.Put(doc))
+	}
+}
+
+func TestCollection_DeleteWhere(t *testing.T) {
+	even := Eq("even", true)
+	all := []string{"00", "01", "02", "03", "04", "05", "06", "07", "08", "09"}
+	tests := []struct {
+		name     string
+		sel      Selector
+		want     int
+		wantLeft []string
+		wantErr  error
+	}{
+		{
+			name:     "index range",
+			sel:      Selector{Index: "score", Params: QueryParams{MinValue: 5, MaxValue: 7}},
+			want:     3,
+			wantLeft: []string{"00", "01", "02", "03", "04", "08", "09"},
+		},
+		{
+			name:     "index range with limit",
+			sel:      Selector{Index: "score", Params: QueryParams{Desc: true, Limit: 2}},
+			want:     2,
+			wantLeft: all[:8],
+		},
+		{
+			name:     "filter",
+			sel:      Selector{Filter: &even},
+			want:     5,
+			wantLeft: []string{"01", "03", "05", "07", "09"},
+		},
+		{
+			name:     "index range and filter",
+			sel:      Selector{Index: "score", Params: QueryParams{MaxValue: 3}, Filter: &even},
+			want:     2,
+			wantLeft: []string{"01", "03", "04", "05", "06", "07", "08", "09"},
+		},
+		{name: "nothing matches", sel: Selector{Index: "score", Params: QueryParams{MinValue: 100}}, wantLeft: all},
+		{name: "no index or filter", sel: Selector{}, wantErr: ErrInvalidQuery},
+		{name: "missing index", sel: Selector{Index: "age"}, wantErr: ErrIndexNotFound},
+		{name: "invalid filter", sel: Selector{Filter: &Filter{Op: "like"}}, wantErr: ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+			assert.NoError(t, c.CreateIndex("score"))
+			scoredUsers(t, c, 10)
+
+			got, err := c.DeleteWhere(tt.sel)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Equal(t, all, pageIDs(c.List()))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantLeft, pageIDs(c.List()))
+			docs, _ := c.Query("score", QueryParams{})
+			assert.Len(t, docs, len(tt.wantLeft))
+		})
+	}
+}
+
+func TestCollection_UpdateWhere(t *testing.T) {
+	c := &Collection{cfg: CollectionConfig{PrimaryKey: "id"}, documents: map[string]Document{}}
+	assert.NoError(t, c.CreateIndex("score"))
+	assert.NoError(t, c.CreateIndexWithConfig(IndexConfig{Fields: []IndexField{{Field: "name"}}, Unique: true}))
+	scoredUsers(t, c, 10)
+
+	even := Eq("even", true)
+	got, err := c.UpdateWhere(Selector{Filter: &even}, Inc("score", 100), Set("bonus", true))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, got)
+	docs, err := c.Query("score", QueryParams{MinValue: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"00", "02", "04", "06", "08"}, pageIDs(docs))
+	for _, doc := range docs {
+		assert.Equal(t, true, doc.Fields["bonus"].Value)
+		assert.Greater(t, doc.Revision, uint64(10))
+	}
+
+	// The even documents have moved out of the range.
+	got, err = c.UpdateWhere(Selector{Index: "score", Params: QueryParams{MaxValue: 2}}, Unset("even"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, got)
+	doc, _ := c.Get("01")
+	_, ok := doc.Fields["even"]
+	assert.False(t, ok)
+
+	// Giving two documents the same unique name fails and changes nothing.
+	_, err = c.UpdateWhere(Selector{Index: "score", Params: QueryParams{MinValue: 7, MaxValue: 9}}, Set("name", "same"))
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+	docs, _ = c.Query("name", QueryParams{MinValue: "same", MaxValue: "same"})
+	assert.Empty(t, docs)
+	doc, _ = c.Get("07")
+	assert.Equal(t, "user7", doc.Fields["name"].Value)
+	assert.Equal(t, uint64(8), doc.Revision)
+
+	// So does changing the primary key.
+	_, err = c.UpdateWhere(Selector{Filter: &even}, Set("id", "x"))
+	assert.ErrorIs(t, err, ErrInvalidUpdate)
+	_, err = c.UpdateWhere(Selector{Filter: &even}, Inc("name", 1))
+	assert.ErrorIs(t, err, ErrInvalidUpdate)
+	assert.Len(t, c.List(), 10)
+}
+
+func TestStore_WhereReplays(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	users, _ := store.CreateCollection("users", &CollectionConfig{PrimaryKey: "id"})
+	assert.NoError(t, users.CreateIndex("score"))
+	scoredUsers(t, users, 10)
+	n, err := users.DeleteWhere(Selector{Index: "score", Params: QueryParams{MinValue: 8}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = users.UpdateWhere(Selector{Index: "score", Params: QueryParams{MaxValue: 1}}, Mul("score", 10))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.NoError(t, store.Close())
+
+	restored, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer restored.Close()
+	users, _ = restored.GetCollection("users")
+	assert.Len(t, users.List(), 8)
+	doc, _ := users.Get("01")
+	assert.Equal(t, 10.0, doc.Fields["score"].Value)
+}